@@ -0,0 +1,24 @@
+// llmconv переводит сохранённую модель llm во float32
+package main
+
+import (
+	"flag"
+	"log"
+	"ml/pkg/llm"
+)
+
+func main() {
+	src := flag.String("src", "", "модель, сохранённая во float64")
+	dst := flag.String("dst", "", "куда сохранить модель во float32")
+	flag.Parse()
+
+	if *src == "" || *dst == "" {
+		flag.Usage()
+		return
+	}
+
+	err := llm.Convert[float32](*src, *dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
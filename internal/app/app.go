@@ -26,19 +26,23 @@ func Run() error {
 		}
 		defer file.Close()
 
-		ans := n.Query(file)
+		ans, err := n.QueryChecked(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		type prob struct {
 			Num int     `json:"num"`
 			Val float64 `json:"val"`
 		}
 
-		probs := make([]prob, 0, len(ans[0]))
+		probs := make([]prob, 0, ans.ColN())
 
-		for i := range ans[0] {
+		for i, val := range ans.Row(0) {
 			probs = append(probs, prob{
 				Num: i,
-				Val: ans[0][i],
+				Val: val,
 			})
 		}
 
@@ -2,7 +2,6 @@ package attnum
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
@@ -11,15 +10,19 @@ import (
 	"ml/pkg/dirreader"
 	"ml/pkg/mat"
 	"ml/pkg/mlutil"
-	"os"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
 	"strconv"
 )
 
 type AttNum struct {
-	MH *attention.MultiHead `json:"mh"`
+	MH *attention.MultiHead[float64] `json:"mh"`
 }
 
-func (num *AttNum) Learn(src string, epochs int, lrate float64) {
+// Learn обучает сеть, ошибка шага tr прерывает обучение
+func (num *AttNum) Learn(src string, epochs int, tr *optim.Trainer[float64]) error {
+	defer nn.Train(nn.Train(true))
+
 	var data []example
 	for ex := range dataset(src) {
 		data = append(data, ex)
@@ -27,53 +30,51 @@ func (num *AttNum) Learn(src string, epochs int, lrate float64) {
 
 	zap.S().Info("start")
 
+	params := num.MH.Parameters()
+
 	for epoch := range epochs {
 		mlutil.Shuffle(data)
 
-		var err float64
+		var total float64
 
 		for i, ex := range data {
-			probs := num.MH.Forward(ex.inp).Softmax()
-			truth := mat.New(probs.RowN(), probs.ColN())
-			truth[0][ex.ans] = 1
-			err += probs.CrossEntropy(truth)
-			num.MH.Backward(probs.Sub(truth), lrate)
+			loss, grad := mat.SoftmaxCrossEntropyGrad(num.MH.Forward(ex.inp), []int{ex.ans})
+			total += loss
+			num.MH.Backward(grad)
+			if err := tr.Step(params, loss); err != nil {
+				return err
+			}
 			if i%256 == 0 && i != 0 {
 				zap.S().Infof("эпоха %d: ошибка %.4f",
-					epoch+1, err/float64(i))
-				err = 0
+					epoch+1, total/float64(i))
+				total = 0
 			}
 		}
 	}
+
+	return nil
 }
 
+// Save сохраняет сеть в файл тензоров
 func (num *AttNum) Save(to string) error {
-	file, err := os.Create(to)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	return mlutil.SaveModel(to, num, num.MH.Tensors("mh."))
+}
 
-	return json.
-		NewEncoder(file).
-		Encode(num)
+// SaveJSON сохраняет сеть в прежнем формате JSON
+func (num *AttNum) SaveJSON(to string) error {
+	return mlutil.SaveJSON(to, num)
 }
 
+// Load загружает сеть из файла тензоров или JSON
 func Load(src string) (*AttNum, error) {
-	file, err := os.Open(src)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
 	var num AttNum
 
-	return &num, json.
-		NewDecoder(file).
-		Decode(&num)
+	return &num, mlutil.LoadModel(src, &num, func() []mat.Tensor[float64] {
+		return num.MH.Tensors("mh.")
+	})
 }
 
-func (num *AttNum) Query(r io.Reader) mat.Mat {
+func (num *AttNum) Query(r io.Reader) mat.Mat[float64] {
 	return num.MH.
 		Forward(mlutil.Img2vec(r)).
 		Softmax()
@@ -81,12 +82,12 @@ func (num *AttNum) Query(r io.Reader) mat.Mat {
 
 func New(xrown, xcoln, wcoln, h int) *AttNum {
 	return &AttNum{
-		MH: attention.NewMultiHead(xrown, xcoln, wcoln, h, 10),
+		MH: attention.NewMultiHead[float64](xrown, xcoln, wcoln, h),
 	}
 }
 
 type example struct {
-	inp mat.Mat
+	inp mat.Mat[float64]
 	ans int
 }
 
@@ -114,16 +115,9 @@ func (num *AttNum) Test(src string) {
 	for ex := range dataset(src) {
 		probs := num.MH.Forward(ex.inp).Softmax()
 
-		maxi := 0
-		maxn := probs[0][maxi]
-		for i := range probs[0] {
-			if probs[0][i] > maxn {
-				maxn = probs[0][i]
-				maxi = i
-			}
-		}
+		_, maxi := probs.MaxIndex()
 
-		for i, prob := range probs[0] {
+		for i, prob := range probs.Row(0) {
 			fmt.Print(i, "->", fmt.Sprintf("%.2f", prob), " ")
 		}
 		fmt.Printf("правильный %d, предсказанный %d\n", ex.ans, maxi)
@@ -2,7 +2,6 @@ package nanonet
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"iter"
@@ -11,7 +10,8 @@ import (
 	"ml/pkg/mat"
 	"ml/pkg/mlp"
 	"ml/pkg/mlutil"
-	"os"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
 	"strconv"
 )
 
@@ -23,7 +23,7 @@ type NanoNet struct {
 //учить буду как большую языковую модель - batch = 1
 
 type Example struct {
-	inp mat.Mat
+	inp mat.Mat[float64]
 	ans int
 }
 
@@ -46,28 +46,34 @@ func Dataset(src string) iter.Seq[Example] {
 }
 
 type NumMLP struct {
-	MLP *mlp.MLP
+	MLP *mlp.MLP[float64]
 }
 
-func (num *NumMLP) Learn(src string, epochs int, lrate float64) {
+func (num *NumMLP) Learn(src string, epochs int, tr *optim.Trainer[float64]) error {
+	defer nn.Train(nn.Train(true))
+
 	var dataset []Example
 	for i := range Dataset(src) {
 		dataset = append(dataset, i)
 	}
 
+	params := num.MLP.Parameters()
+
 	for epoch := range epochs {
 		mlutil.Shuffle(dataset)
 		for _, i := range dataset {
-			probs := num.MLP.Forward(i.inp).Softmax()
-
-			truth := mat.New(probs.RowN(), probs.ColN())
-			truth[0][i.ans] = 1
+			loss, grad := mat.SoftmaxCrossEntropyGrad(num.MLP.Forward(i.inp), []int{i.ans})
 
-			zap.S().Infof("%d: error: %.4f", epoch, probs.CrossEntropy(truth))
+			zap.S().Infof("%d: error: %.4f", epoch, loss)
 
-			num.MLP.BackwardMut(probs.Sub(truth), lrate)
+			num.MLP.Backward(grad)
+			if err := tr.Step(params, loss); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
 
 func (num *NumMLP) Test(src string) {
@@ -75,16 +81,9 @@ func (num *NumMLP) Test(src string) {
 
 	for ex := range Dataset(src) {
 		probs := num.MLP.Forward(ex.inp).Softmax()
-		maxi := 0
-		maxn := probs[0][maxi]
-		for i := range probs[0] {
-			if probs[0][i] > maxn {
-				maxn = probs[0][i]
-				maxi = i
-			}
-		}
+		_, maxi := probs.MaxIndex()
 
-		for i, prob := range probs[0] {
+		for i, prob := range probs.Row(0) {
 			fmt.Print(i, "->", fmt.Sprintf("%.2f", prob), " ")
 		}
 		fmt.Printf("правильный %d, предсказанный %d\n", ex.ans, maxi)
@@ -98,78 +97,117 @@ func (num *NumMLP) Test(src string) {
 }
 
 func (num *NumMLP) Save(to string) {
-	file, err := os.Create(to)
+	err := mlutil.SaveModel(to, num, num.tensors())
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
+}
 
-	err = json.
-		NewEncoder(file).
-		Encode(num)
-	if err != nil {
-		panic(err)
+func (num *NumMLP) tensors() []mat.Tensor[float64] {
+	return num.MLP.Tensors("mlp.")
+}
+
+func LoadNumMLP(src string) (*NumMLP, error) {
+	var num NumMLP
+
+	if err := mlutil.LoadModel(src, &num, num.tensors); err != nil {
+		return nil, err
 	}
+	mlp.WarnBias(src, mlp.CollapseBias(num.MLP))
+
+	return &num, nil
 }
 
 func NewNumMLP(xrown, xcoln int, wcolns ...int) *NumMLP {
 	return &NumMLP{
-		MLP: mlp.New(.01, xrown, xcoln, wcolns...),
+		MLP: mlp.New[float64](.01, xrown, xcoln, wcolns...),
 	}
 }
 
 type NumMLPNorm struct {
-	MLP     *mlp.MLP
-	LayNorm *laynorm.LayNorm
-	MLP2    *mlp.MLP
+	MLP     *mlp.MLP[float64]
+	LayNorm *laynorm.LayNorm[float64]
+	MLP2    *mlp.MLP[float64]
 }
 
 func (num *NumMLPNorm) Save(to string) {
-	file, err := os.Create(to)
+	err := mlutil.SaveModel(to, num, num.tensors())
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
+}
 
-	err = json.
-		NewEncoder(file).
-		Encode(num)
-	if err != nil {
-		panic(err)
+func (num *NumMLPNorm) tensors() []mat.Tensor[float64] {
+	tensors := num.MLP.Tensors("mlp.")
+	tensors = append(tensors, num.LayNorm.Tensors("laynorm.")...)
+	return append(tensors, num.MLP2.Tensors("mlp2.")...)
+}
+
+func LoadNumMLPNorm(src string) (*NumMLPNorm, error) {
+	var num NumMLPNorm
+
+	if err := mlutil.LoadModel(src, &num, num.tensors); err != nil {
+		return nil, err
 	}
+	mlp.WarnBias(src, mlp.CollapseBias(num.MLP, num.MLP2))
+
+	return &num, nil
 }
 
-func (num *NumMLPNorm) Learn(src string, epochs int, lrate float64) {
+func (num *NumMLPNorm) Learn(src string, epochs int, tr *optim.Trainer[float64]) error {
+	defer nn.Train(nn.Train(true))
+
 	var dataset []Example
 	for i := range Dataset(src) {
 		dataset = append(dataset, i)
 	}
 
+	params := num.Parameters()
+
 	for epoch := range epochs {
 		mlutil.Shuffle(dataset)
 		for _, i := range dataset {
-			probs := num.MLP2.Forward(
-				num.LayNorm.Forward(
-					num.MLP.Forward(i.inp)),
-			).Softmax()
-
-			truth := mat.New(probs.RowN(), probs.ColN())
-			truth[0][i.ans] = 1
-
-			zap.S().Infof("%d: error: %.4f", epoch, probs.CrossEntropy(truth))
+			loss, err := num.learn(i, params, tr)
+			if err != nil {
+				return err
+			}
 
-			num.MLP.BackwardMut(
-				num.LayNorm.Backward(
-					num.MLP2.BackwardMut(probs.Sub(truth), lrate), lrate), lrate)
+			zap.S().Infof("%d: error: %.4f", epoch, loss)
 		}
 	}
+
+	return nil
+}
+
+// learn шаг обучения на примере ex, возвращает ошибку до шага
+func (num *NumMLPNorm) learn(ex Example, params []*nn.Param[float64], tr *optim.Trainer[float64]) (float64, error) {
+	logits := num.MLP2.Forward(
+		num.LayNorm.Forward(
+			num.MLP.Forward(ex.inp)),
+	)
+
+	loss, grad := mat.SoftmaxCrossEntropyGrad(logits, []int{ex.ans})
+
+	num.MLP.Backward(
+		num.LayNorm.Backward(
+			num.MLP2.Backward(grad)))
+
+	return loss, tr.Step(params, loss)
+}
+
+// Parameters параметры сети с теми же именами, что в tensors.
+// Без префиксов MLP и MLP2 дали бы одинаковые имена, и оптимизатор смешал бы их состояние.
+func (num *NumMLPNorm) Parameters() []*nn.Param[float64] {
+	params := nn.Prefix("mlp.", num.MLP.Parameters())
+	params = append(params, nn.Prefix("laynorm.", num.LayNorm.Parameters())...)
+	return append(params, nn.Prefix("mlp2.", num.MLP2.Parameters())...)
 }
 
 func NewNumMLPNorm(xrown, xcoln int, wcoln1, wcoln2 int) *NumMLPNorm {
 	return &NumMLPNorm{
-		MLP:     mlp.New(.01, xrown, xcoln, wcoln1),
-		LayNorm: laynorm.New(wcoln1),
-		MLP2:    mlp.New(.01, xrown, wcoln1, wcoln2),
+		MLP:     mlp.New[float64](.01, xrown, xcoln, wcoln1),
+		LayNorm: laynorm.New[float64](wcoln1),
+		MLP2:    mlp.New[float64](.01, xrown, wcoln1, wcoln2),
 	}
 }
 
@@ -181,16 +219,9 @@ func (num *NumMLPNorm) Test(src string) {
 			num.LayNorm.Forward(
 				num.MLP.Forward(ex.inp)),
 		).Softmax()
-		maxi := 0
-		maxn := probs[0][maxi]
-		for i := range probs[0] {
-			if probs[0][i] > maxn {
-				maxn = probs[0][i]
-				maxi = i
-			}
-		}
+		_, maxi := probs.MaxIndex()
 
-		for i, prob := range probs[0] {
+		for i, prob := range probs.Row(0) {
 			fmt.Print(i, "->", fmt.Sprintf("%.2f", prob), " ")
 		}
 		fmt.Printf("правильный %d, предсказанный %d\n", ex.ans, maxi)
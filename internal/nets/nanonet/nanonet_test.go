@@ -0,0 +1,49 @@
+package nanonet
+
+import (
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
+	"strings"
+	"testing"
+)
+
+func Test_NumMLPNorm_Parameters(t *testing.T) {
+	num := NewNumMLPNorm(1, 6, 4, 3)
+	params := num.Parameters()
+
+	names := make(map[string]*nn.Param[float64], len(params))
+	for _, p := range params {
+		if _, ok := names[p.Name]; ok {
+			t.Fatalf("имя %s повторяется", p.Name)
+		}
+		names[p.Name] = p
+	}
+	for i, tensor := range num.tensors() {
+		if p := params[i]; p.Name != tensor.Name || p.Value != tensor.Mat {
+			t.Errorf("%d: %s != %s", i, p.Name, tensor.Name)
+		}
+	}
+
+	//у каждого параметра свои моменты Adam его размера
+	opt := optim.NewAdam[float64](.01)
+	tr := optim.NewTrainer[float64](opt)
+	for ans := range 3 {
+		if _, err := num.learn(Example{inp: mat.New[float64](1, 6).Rand(), ans: ans}, params, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := opt.State()
+	if len(state) != 2*len(params) {
+		t.Fatalf("%d матриц состояния для %d параметров", len(state), len(params))
+	}
+	for _, s := range state {
+		//optim.<момент>.<параметр>
+		name := s.Name[strings.Index(s.Name[len("optim."):], ".")+len("optim.")+1:]
+		p, ok := names[name]
+		if !ok || p.Value.RowN() != s.Mat.RowN() || p.Value.ColN() != s.Mat.ColN() {
+			t.Errorf("%s: %dx%d", s.Name, s.Mat.RowN(), s.Mat.ColN())
+		}
+	}
+}
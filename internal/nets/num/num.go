@@ -2,7 +2,6 @@ package num
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
 	"io"
@@ -11,87 +10,112 @@ import (
 	"ml/pkg/mat"
 	"ml/pkg/mlp"
 	"ml/pkg/mlutil"
-	"os"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
 	"slices"
 	"strconv"
+	"sync"
 )
 
 type Num struct {
-	MLP *mlp.MLP `json:"mlp"`
+	MLP *mlp.MLP[float64] `json:"mlp"`
+
+	//слои переиспользуют буферы, поэтому запросы к общей сети идут по одному
+	mu sync.Mutex
 }
 
-func (num *Num) Learn(src string, epochs, pkgSize int, lrate float64) {
+// Learn обучает сеть на изображениях из src и возвращает ошибку шага tr
+func (num *Num) Learn(src string, epochs, pkgSize int, tr *optim.Trainer[float64]) error {
+	defer nn.Train(nn.Train(true))
+
 	var data []example
 	for ex := range dataset(src) {
 		data = append(data, ex)
 	}
 
+	params := num.MLP.Parameters()
+
 	for epoch := range epochs {
 		mlutil.Shuffle(data)
 		var pkgi int
 
 		for pkg := range slices.Chunk(data, pkgSize) {
-			var err float64
+			var total float64
 
 			for _, ex := range pkg {
-				probs := num.MLP.Forward(ex.inp).Softmax()
+				loss, grad := mat.SoftmaxCrossEntropyGrad(num.MLP.Forward(ex.inp), []int{ex.ans})
 
-				truth := mat.New(probs.RowN(), probs.ColN())
-				truth[0][ex.ans] = 1
+				total += loss
 
-				err += probs.CrossEntropy(truth)
-
-				num.MLP.BackwardMut(probs.Sub(truth), lrate)
+				num.MLP.Backward(grad)
+				if err := tr.Step(params, loss); err != nil {
+					return err
+				}
 			}
 
 			zap.S().Infof("эпоха %d, пакет %d: ошибка %.4f",
-				epoch+1, pkgi+1, err/float64(pkgSize))
+				epoch+1, pkgi+1, total/float64(pkgSize))
 
 			pkgi++
 		}
 	}
+
+	return nil
 }
 
+// Save сохраняет сеть в файл тензоров
 func (num *Num) Save(to string) error {
-	file, err := os.Create(to)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	return mlutil.SaveModel(to, num, num.MLP.Tensors("mlp."))
+}
 
-	return json.
-		NewEncoder(file).
-		Encode(num)
+// SaveJSON сохраняет сеть в прежнем формате JSON
+func (num *Num) SaveJSON(to string) error {
+	return mlutil.SaveJSON(to, num)
 }
 
+// Load загружает сеть из файла тензоров или JSON
 func Load(src string) (*Num, error) {
-	file, err := os.Open(src)
+	var num Num
+
+	err := mlutil.LoadModel(src, &num, func() []mat.Tensor[float64] {
+		return num.MLP.Tensors("mlp.")
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	var num Num
+	mlp.WarnBias(src, mlp.CollapseBias(num.MLP))
 
-	return &num, json.
-		NewDecoder(file).
-		Decode(&num)
+	return &num, nil
 }
 
-func (num *Num) Query(r io.Reader) mat.Mat {
+// Query можно вызывать из нескольких горутин
+func (num *Num) Query(r io.Reader) mat.Mat[float64] {
+	x := mlutil.Img2vec(r)
+
+	num.mu.Lock()
+	defer num.mu.Unlock()
+
 	return num.MLP.
-		Forward(mlutil.Img2vec(r)).
+		Forward(x).
 		Softmax()
 }
 
+// QueryChecked то же, что Query, но возвращает ошибку,
+// если размер изображения не подходит сети
+func (num *Num) QueryChecked(r io.Reader) (ans mat.Mat[float64], err error) {
+	defer mat.Catch(&err)
+	return num.Query(r), nil
+}
+
 func New(alpha float64, xrown, xcoln int, wcolns ...int) *Num {
 	return &Num{
-		MLP: mlp.New(alpha, xrown, xcoln, wcolns...),
+		MLP: mlp.New[float64](alpha, xrown, xcoln, wcolns...),
 	}
 }
 
 type example struct {
-	inp mat.Mat
+	inp mat.Mat[float64]
 	ans int
 }
 
@@ -119,16 +143,9 @@ func (num *Num) Test(src string) {
 	for ex := range dataset(src) {
 		probs := num.MLP.Forward(ex.inp).Softmax()
 
-		maxi := 0
-		maxn := probs[0][maxi]
-		for i := range probs[0] {
-			if probs[0][i] > maxn {
-				maxn = probs[0][i]
-				maxi = i
-			}
-		}
+		_, maxi := probs.MaxIndex()
 
-		for i, prob := range probs[0] {
+		for i, prob := range probs.Row(0) {
 			fmt.Print(i, "->", fmt.Sprintf("%.2f", prob), " ")
 		}
 		fmt.Printf("правильный %d, предсказанный %d\n", ex.ans, maxi)
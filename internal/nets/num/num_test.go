@@ -0,0 +1,59 @@
+package num
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+	"testing"
+)
+
+// jpg изображение size x size с оттенком shade
+func jpg(t *testing.T, size int, shade uint8) []byte {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			img.SetGray(x, y, color.Gray{Y: shade + uint8(x*y)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_Query_Parallel(t *testing.T) {
+	const size = 8
+	n := New(.01, 1, size*size, 16, 10)
+
+	var imgs [][]byte
+	var want [][]float64
+	for shade := range 4 {
+		img := jpg(t, size, uint8(shade*60))
+		imgs = append(imgs, img)
+		want = append(want, n.Query(bytes.NewReader(img)).Row(0))
+	}
+
+	//запросы к общей сети не портят ответы друг друга
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				k := (g + i) % len(imgs)
+				ans := n.Query(bytes.NewReader(imgs[k]))
+				for col, val := range ans.Row(0) {
+					if val != want[k][col] {
+						t.Errorf("%d: %v != %v", k, ans.Row(0), want[k])
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
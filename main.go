@@ -35,7 +35,7 @@ func main() {
 	//	panic(err)
 	//}
 
-	//LLM := llm.New(
+	//LLM := llm.New[float64](
 	//	layerN,
 	//	ctxSize,
 	//	embSize,
@@ -45,7 +45,7 @@ func main() {
 	//	dictSrc+"\\tokens.json",
 	//)
 
-	LLM, err := llm.Load("C:\\Users\\sergey\\Desktop\\ml\\llm\\data\\llm", ctxSize)
+	LLM, err := llm.Load[float64]("C:\\Users\\sergey\\Desktop\\ml\\llm\\data\\llm", ctxSize)
 	if err != nil {
 		panic(err)
 	}
@@ -54,9 +54,19 @@ func main() {
 	fmt.Printf("запрос: %s\nответ: ", query)
 	LLM.Query(query)
 
+	//расписание сдвигается на каждом окне, а не на каждой шутке
+	//var steps int
+	//for _, joke := range jokes.Jokes {
+	//	steps += LLM.Steps(joke)
+	//}
+	//opt := optim.NewAdamW[float64](.0003, .01)
+	//sched := &schedule.Cosine{Rate: .0003, Min: .00003, Warmup: 100, Total: 4 * steps}
+	//tr := &optim.Trainer[float64]{Opt: opt, Sched: sched, MaxNorm: 1, Rollback: true}
 	//for epoch := range 4 {
 	//	for i, joke := range jokes.Jokes {
-	//		LLM.Learn(joke, .0001, fmt.Sprintf("%d %d", epoch, i))
+	//		if err := LLM.Learn(joke, tr, fmt.Sprintf("%d %d", epoch, i)); err != nil {
+	//			panic(err)
+	//		}
 	//	}
 	//}
 
@@ -0,0 +1,153 @@
+// Package activation функции активации и их производные.
+// Функция выбирается по имени, которое хранится в JSON моделей.
+package activation
+
+import (
+	"fmt"
+	"math"
+	"ml/pkg/mat"
+)
+
+// Name имя функции активации
+type Name string
+
+const (
+	// LeakyReLU max(alpha*x, x)
+	LeakyReLU Name = "leakyrelu"
+	ReLU      Name = "relu"
+	// GELU x * Φ(x), Φ - функция нормального распределения
+	GELU Name = "gelu"
+	// GELUTanh приближение GELU через tanh, как в GPT-2
+	GELUTanh Name = "gelu_tanh"
+	// SiLU x * sigmoid(x), также Swish
+	SiLU     Name = "silu"
+	Tanh     Name = "tanh"
+	Sigmoid  Name = "sigmoid"
+	Softplus Name = "softplus"
+	// ELU x при x > 0, иначе alpha*(e^x - 1)
+	ELU Name = "elu"
+)
+
+// Names все функции активации
+var Names = []Name{LeakyReLU, ReLU, GELU, GELUTanh, SiLU, Tanh, Sigmoid, Softplus, ELU}
+
+// Check возвращает ошибку, если функции с именем name нет
+func Check(name Name) error {
+	for _, n := range Names {
+		if n == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("неизвестная функция активации %q", name)
+}
+
+// ForwardTo записывает name(x) в dst. alpha - параметр LeakyReLU и ELU.
+// dst может совпадать с x.
+func ForwardTo[T mat.Float](name Name, dst, x mat.Mat[T], alpha float64) mat.Mat[T] {
+	for row := range x.RowN() {
+		dstrow := dst.Row(row)
+		for col, v := range x.Row(row) {
+			dstrow[col] = T(f(name, float64(v), alpha))
+		}
+	}
+
+	return dst
+}
+
+// DerTo записывает производную name в точках x в dst
+func DerTo[T mat.Float](name Name, dst, x mat.Mat[T], alpha float64) mat.Mat[T] {
+	for row := range x.RowN() {
+		dstrow := dst.Row(row)
+		for col, v := range x.Row(row) {
+			dstrow[col] = T(df(name, float64(v), alpha))
+		}
+	}
+
+	return dst
+}
+
+func Forward[T mat.Float](name Name, x mat.Mat[T], alpha float64) mat.Mat[T] {
+	return ForwardTo(name, mat.New[T](x.RowN(), x.ColN()), x, alpha)
+}
+
+func Der[T mat.Float](name Name, x mat.Mat[T], alpha float64) mat.Mat[T] {
+	return DerTo(name, mat.New[T](x.RowN(), x.ColN()), x, alpha)
+}
+
+// коэффициенты приближения GELU через tanh
+const (
+	geluC = 0.7978845608028654 //sqrt(2/pi)
+	geluA = 0.044715
+)
+
+func f(name Name, x, alpha float64) float64 {
+	switch name {
+	case LeakyReLU:
+		return max(x*alpha, x)
+	case ReLU:
+		return max(x, 0)
+	case GELU:
+		return x * normCDF(x)
+	case GELUTanh:
+		return .5 * x * (1 + math.Tanh(geluC*(x+geluA*x*x*x)))
+	case SiLU:
+		return x * sigmoid(x)
+	case Tanh:
+		return math.Tanh(x)
+	case Sigmoid:
+		return sigmoid(x)
+	case Softplus:
+		return max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+	case ELU:
+		if x > 0 {
+			return x
+		}
+		return alpha * math.Expm1(x)
+	}
+	panic(Check(name))
+}
+
+func df(name Name, x, alpha float64) float64 {
+	switch name {
+	case LeakyReLU:
+		if x >= 0 {
+			return 1
+		}
+		return alpha
+	case ReLU:
+		if x > 0 {
+			return 1
+		}
+		return 0
+	case GELU:
+		return normCDF(x) + x*math.Exp(-x*x/2)/math.Sqrt(2*math.Pi)
+	case GELUTanh:
+		t := math.Tanh(geluC * (x + geluA*x*x*x))
+		return .5*(1+t) + .5*x*(1-t*t)*geluC*(1+3*geluA*x*x)
+	case SiLU:
+		s := sigmoid(x)
+		return s * (1 + x*(1-s))
+	case Tanh:
+		t := math.Tanh(x)
+		return 1 - t*t
+	case Sigmoid:
+		s := sigmoid(x)
+		return s * (1 - s)
+	case Softplus:
+		return sigmoid(x)
+	case ELU:
+		if x > 0 {
+			return 1
+		}
+		return alpha * math.Exp(x)
+	}
+	panic(Check(name))
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func normCDF(x float64) float64 {
+	return .5 * (1 + math.Erf(x/math.Sqrt2))
+}
@@ -0,0 +1,69 @@
+package activation
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"testing"
+)
+
+func Test_Der(t *testing.T) {
+	const h = 1e-6
+
+	//точки вне изломов ReLU, LeakyReLU и ELU
+	x := mat.FromRows([][]float64{
+		{-3, -1.2, -.5, -.01},
+		{.01, .3, 1.7, 4},
+	})
+
+	for _, name := range Names {
+		der := Der(name, x, .1)
+
+		for row := range x.RowN() {
+			for col := range x.ColN() {
+				v := x.At(row, col)
+				num := (f(name, v+h, .1) - f(name, v-h, .1)) / (2 * h)
+				if math.Abs(num-der.At(row, col)) > 1e-6 {
+					t.Errorf("%s(%v): %v != %v", name, v, der.At(row, col), num)
+				}
+			}
+		}
+	}
+}
+
+func Test_Forward(t *testing.T) {
+	x := mat.FromRows([][]float64{{-1, 0, 2}})
+
+	tests := []struct {
+		name Name
+		ans  []float64
+	}{
+		{name: LeakyReLU, ans: []float64{-.1, 0, 2}},
+		{name: ReLU, ans: []float64{0, 0, 2}},
+		{name: GELU, ans: []float64{-0.15865525393145707, 0, 1.9544997361036416}},
+		{name: GELUTanh, ans: []float64{-0.15880800939172324, 0, 1.9545976940871754}},
+		{name: SiLU, ans: []float64{-0.2689414213699951, 0, 1.7615941559557649}},
+		{name: Tanh, ans: []float64{-0.7615941559557649, 0, 0.9640275800758169}},
+		{name: Sigmoid, ans: []float64{0.2689414213699951, .5, 0.8807970779778823}},
+		{name: Softplus, ans: []float64{0.31326168751822286, math.Ln2, 2.1269280110429727}},
+		{name: ELU, ans: []float64{-0.06321205588285576, 0, 2}},
+	}
+
+	for i, test := range tests {
+		ans := Forward(test.name, x, .1).Row(0)
+		for col := range ans {
+			if math.Abs(ans[col]-test.ans[col]) > 1e-12 {
+				t.Errorf("%d: %s %v != %v", i+1, test.name, ans, test.ans)
+				break
+			}
+		}
+	}
+}
+
+func Test_Check(t *testing.T) {
+	if err := Check(GELU); err != nil {
+		t.Error(err)
+	}
+	if err := Check("swish"); err == nil {
+		t.Error("нет ошибки")
+	}
+}
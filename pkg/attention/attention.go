@@ -1,109 +1,229 @@
 package attention
 
 import (
+	"fmt"
 	"math"
+	"ml/pkg/dropout"
+	"ml/pkg/initializer"
 	"ml/pkg/mat"
-	"ml/pkg/mlutil"
+	"ml/pkg/nn"
 )
 
-type Head struct {
-	Q                mat.Mat `json:"q"`
-	K                mat.Mat `json:"k"`
-	V                mat.Mat `json:"v"`
-	KLenSqrt         float64 `json:"kLenSqrt"`
-	x, a, xQ, xK, xV mat.Mat
+type Head[T mat.Float] struct {
+	Q                mat.Mat[T] `json:"q"`
+	K                mat.Mat[T] `json:"k"`
+	V                mat.Mat[T] `json:"v"`
+	KLenSqrt         float64    `json:"kLenSqrt"`
+	x, a, xQ, xK, xV mat.Mat[T]
+	ans, dx          mat.Mat[T]
+	dq, dk, dv       mat.Mat[T]
+
+	// Mask прибавляется к оценкам внимания, пустая маска ничего не запрещает.
+	// MultiHead передаёт головам свою маску.
+	Mask mat.Mat[T] `json:"-"`
+
+	// Drop обнуляет вероятности внимания при обучении, nil - без dropout
+	Drop *dropout.Dropout[T] `json:"dropout,omitempty"`
+	//вероятности после Drop
+	p mat.Mat[T]
 }
 
-func NewHead(wrown, wcoln int) *Head {
-	return &Head{
-		Q:        mat.New(wrown, wcoln).Rand(),
-		K:        mat.New(wrown, wcoln).Rand(),
-		V:        mat.New(wrown, wcoln).Rand(),
+var (
+	_ nn.Module[float64] = (*Head[float64])(nil)
+	_ nn.Module[float64] = (*MultiHead[float64])(nil)
+)
+
+// NewHead создаёт голову внимания.
+// Необязательный init заполняет Q, K и V, по умолчанию initializer.HeNormal.
+func NewHead[T mat.Float](wrown, wcoln int, init ...initializer.Init) *Head[T] {
+	w := initializer.Pick(init, initializer.HeNormal)
+
+	return &Head[T]{
+		Q:        initializer.New[T](wrown, wcoln, w),
+		K:        initializer.New[T](wrown, wcoln, w),
+		V:        initializer.New[T](wrown, wcoln, w),
 		KLenSqrt: math.Sqrt(float64(wcoln)),
 	}
 }
 
-func (h *Head) Forward(x, mask mat.Mat) mat.Mat {
+func (h *Head[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	rown, coln := x.RowN(), h.Q.ColN()
+
 	h.x = x
-	h.xQ, h.xK, h.xV = h.x.Mul(h.Q), h.x.Mul(h.K), h.x.Mul(h.V)
-	s := h.xQ.Mul(h.xK.T()).Scale(1 / h.KLenSqrt).Add(mask)
-	h.a = s.Softmax()
-	return h.a.Mul(h.xV)
+	h.xQ = h.x.MulTo(mat.Reuse(h.xQ, rown, coln), h.Q)
+	h.xK = h.x.MulTo(mat.Reuse(h.xK, rown, coln), h.K)
+	h.xV = h.x.MulTo(mat.Reuse(h.xV, rown, coln), h.V)
+	s := h.xQ.MulTTo(mat.Reuse(h.a, rown, rown), h.xK).
+		ScaleInPlace(T(1 / h.KLenSqrt))
+	if h.Mask.RowN() != 0 {
+		s.AddInPlace(h.Mask)
+	}
+	h.a = s.SoftmaxTo(s)
+	h.p = h.Drop.Forward(h.a)
+	h.ans = h.p.MulTo(mat.Reuse(h.ans, rown, coln), h.xV)
+	return h.ans
 }
 
-func (h *Head) Backward(do mat.Mat, lrate float64) mat.Mat {
-	da := do.Mul(h.xV.T())
-	sum := h.a.MulElwise(da).RowSum()
-	ds := h.a.MulElwise(da.Sub1(sum))
-	dxQ := ds.Mul(h.xK.Scale(1 / h.KLenSqrt))
-	dxK := ds.T().Mul(h.xQ.Scale(1 / h.KLenSqrt))
-	dxV := h.a.T().Mul(do)
-
-	xT := h.x.T()
-	dx := dxQ.Mul(h.Q.T()).Add(dxK.Mul(h.K.T())).Add(dxV.Mul(h.V.T()))
-
-	h.Q = mlutil.Upd(h.Q, xT.Mul(dxQ), lrate)
-	h.K = mlutil.Upd(h.K, xT.Mul(dxK), lrate)
-	h.V = mlutil.Upd(h.V, xT.Mul(dxV), lrate)
+func (h *Head[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	rown, coln := do.RowN(), do.ColN()
+
+	da := do.MulTTo(mat.Get[T](rown, rown), h.xV)
+	dp := h.Drop.Backward(da)
+	ds := h.a.MulElwiseTo(mat.Get[T](rown, rown), dp)
+	sum := ds.RowSumTo(mat.Get[T](rown, 1))
+	ds = h.a.MulElwiseTo(ds, dp.SubTo(dp, sum))
+	dxQ := ds.MulTo(mat.Get[T](rown, coln), h.xK).ScaleInPlace(T(1 / h.KLenSqrt))
+	dxK := ds.TMulTo(mat.Get[T](rown, coln), h.xQ).ScaleInPlace(T(1 / h.KLenSqrt))
+	dxV := h.p.TMulTo(mat.Get[T](rown, coln), do)
+
+	prod := mat.Get[T](rown, h.Q.RowN())
+	h.dx = dxQ.MulTTo(mat.Reuse(h.dx, rown, h.Q.RowN()), h.Q).
+		AddInPlace(dxK.MulTTo(prod, h.K)).
+		AddInPlace(dxV.MulTTo(prod, h.V))
+
+	dw := mat.Get[T](h.Q.RowN(), h.Q.ColN())
+	nn.Accumulate(&h.dq, h.x.TMulTo(dw, dxQ))
+	nn.Accumulate(&h.dk, h.x.TMulTo(dw, dxK))
+	nn.Accumulate(&h.dv, h.x.TMulTo(dw, dxV))
+
+	for _, m := range []mat.Mat[T]{da, ds, sum, dxQ, dxK, dxV, prod, dw} {
+		mat.Put(m)
+	}
 
-	return dx
+	return h.dx
 }
 
-type MultiHead struct {
-	Heads []*Head `json:"heads"`
-	Mask  mat.Mat `json:"mask"`
-	Out   mat.Mat `json:"out"`
-	matsc mat.Mat
+type MultiHead[T mat.Float] struct {
+	Heads []*Head[T] `json:"heads"`
+	Mask  mat.Mat[T] `json:"mask"`
+	Out   mat.Mat[T] `json:"out"`
+	matsc mat.Mat[T]
+	outs  []mat.Mat[T]
+	ans   mat.Mat[T]
+	dx    mat.Mat[T]
+	dout  mat.Mat[T]
 }
 
-func NewMultiHead(xrown, xcoln, wcoln, h int) *MultiHead {
-	heads := make([]*Head, h)
+// NewMultiHead создаёт h голов внимания.
+// Необязательный init заполняет веса голов и Out,
+// по умолчанию головы заполняются initializer.HeNormal, а Out нулями.
+func NewMultiHead[T mat.Float](xrown, xcoln, wcoln, h int, init ...initializer.Init) *MultiHead[T] {
+	w := initializer.Pick(init, initializer.HeNormal)
+	out := initializer.Pick(init, initializer.Zeros)
+
+	heads := make([]*Head[T], h)
 	for i := range h {
-		heads[i] = NewHead(xcoln, wcoln)
+		heads[i] = NewHead[T](xcoln, wcoln, w)
 	}
 
-	mask := mat.New(xrown, xrown)
-	for row := range mask {
-		for col := range mask[row] {
-			if row < col {
-				mask[row][col] = math.Inf(-1)
-			}
+	return &MultiHead[T]{
+		Heads: heads,
+		Mask:  CausalMask[T](xrown),
+		Out:   initializer.New[T](wcoln*h, xcoln, out),
+	}
+}
+
+// SetDropout включает dropout вероятностей внимания во всех головах.
+// Голова i получает начальное значение seed+i.
+func (mh *MultiHead[T]) SetDropout(rate float64, seed uint64) error {
+	for i, h := range mh.Heads {
+		drop, err := dropout.New[T](rate, seed+uint64(i))
+		if err != nil {
+			return err
 		}
+		h.Drop = drop
 	}
+	return nil
+}
 
-	return &MultiHead{
-		Heads: heads,
-		Mask:  mask,
-		Out:   mat.New(wcoln*h, xcoln),
+// CausalMask возвращает маску n x n, запрещающую смотреть на следующие токены
+func CausalMask[T mat.Float](n int) mat.Mat[T] {
+	mask := mat.New[T](n, n)
+	for row := range mask.RowN() {
+		for col := row + 1; col < mask.ColN(); col++ {
+			mask.Set(row, col, T(math.Inf(-1)))
+		}
 	}
+	return mask
 }
 
-func (mh *MultiHead) Forward(x mat.Mat) mat.Mat {
-	matrices := make([]mat.Mat, 0, len(mh.Heads))
-	for _, h := range mh.Heads {
-		matrices = append(matrices, h.Forward(x, mh.Mask))
+func (mh *MultiHead[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	mh.outs = mh.outs[:0]
+	for i, h := range mh.Heads {
+		h.Mask = mh.Mask
+		mh.outs = append(mh.outs, headForward(i, h, x))
 	}
-	mh.matsc = mat.Concat(matrices...)
-	return mh.matsc.Mul(mh.Out)
+	mh.matsc = mat.ConcatTo(mat.Reuse(mh.matsc, x.RowN(), mh.Out.RowN()), mh.outs...)
+	mh.ans = mh.matsc.MulTo(mat.Reuse(mh.ans, x.RowN(), mh.Out.ColN()), mh.Out)
+	return mh.ans
 }
 
-func (mh *MultiHead) Backward(do mat.Mat, lrate float64) mat.Mat {
-	mh.Out = mlutil.Upd(mh.Out, mh.matsc.T().Mul(do), lrate)
+func (mh *MultiHead[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	dout := mh.matsc.TMulTo(mat.Get[T](mh.Out.RowN(), mh.Out.ColN()), do)
+	nn.Accumulate(&mh.dout, dout)
 
-	ders := mat.Split(
-		do.Mul(mh.Out.T()),
-		len(mh.Heads),
-	)
+	dmatsc := do.MulTTo(mat.Get[T](do.RowN(), mh.Out.RowN()), mh.Out)
+	ders := mat.Split(dmatsc, len(mh.Heads))
 
-	var dx mat.Mat
 	for i, der := range ders {
-		d := mh.Heads[i].Backward(der, lrate)
-		if dx == nil {
-			dx = d
+		d := headBackward(i, mh.Heads[i], der)
+		if i == 0 {
+			mh.dx = mat.Reuse(mh.dx, d.RowN(), d.ColN()).Copy(d)
 			continue
 		}
-		dx = dx.Add(d)
+		mh.dx = mh.dx.AddInPlace(d)
 	}
 
-	return dx
+	mat.Put(dout)
+	mat.Put(dmatsc)
+
+	return mh.dx
+}
+
+// headForward и headBackward добавляют номер головы к ошибкам размеров
+func headForward[T mat.Float](i int, h *Head[T], x mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("head", i)
+	return h.Forward(x)
+}
+
+func headBackward[T mat.Float](i int, h *Head[T], do mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("head", i)
+	return h.Backward(do)
+}
+
+// Tensors возвращает матрицы головы с именами для сохранения в файл
+func (h *Head[T]) Tensors(prefix string) []mat.Tensor[T] {
+	return []mat.Tensor[T]{
+		{Name: prefix + "q", Mat: &h.Q},
+		{Name: prefix + "k", Mat: &h.K},
+		{Name: prefix + "v", Mat: &h.V},
+	}
+}
+
+func (mh *MultiHead[T]) Tensors(prefix string) []mat.Tensor[T] {
+	var tensors []mat.Tensor[T]
+	for i, h := range mh.Heads {
+		tensors = append(tensors, h.Tensors(fmt.Sprintf("%sheads.%d.", prefix, i))...)
+	}
+	return append(tensors,
+		mat.Tensor[T]{Name: prefix + "mask", Mat: &mh.Mask},
+		mat.Tensor[T]{Name: prefix + "out", Mat: &mh.Out},
+	)
+}
+
+func (h *Head[T]) Parameters() []*nn.Param[T] {
+	return []*nn.Param[T]{
+		{Name: "q", Value: &h.Q, Grad: &h.dq},
+		{Name: "k", Value: &h.K, Grad: &h.dk},
+		{Name: "v", Value: &h.V, Grad: &h.dv},
+	}
+}
+
+// Parameters без маски, она не обучается
+func (mh *MultiHead[T]) Parameters() []*nn.Param[T] {
+	var params []*nn.Param[T]
+	for i, h := range mh.Heads {
+		params = append(params, nn.Prefix(fmt.Sprintf("heads.%d.", i), h.Parameters())...)
+	}
+	return append(params, &nn.Param[T]{Name: "out", Value: &mh.Out, Grad: &mh.dout})
 }
@@ -2,55 +2,152 @@ package attention
 
 import (
 	"math"
+	"ml/pkg/dropout"
+	"ml/pkg/gradcheck"
+	"ml/pkg/initializer"
 	"ml/pkg/mat"
-	"reflect"
+	"ml/pkg/nn"
 	"testing"
 )
 
 func Test_Head_Forward(t *testing.T) {
 	tests := []struct {
-		x, m, ans mat.Mat
-		h         *Head
+		x, m, ans mat.Mat[float64]
+		h         *Head[float64]
 	}{
 		{
-			x: mat.Mat{
+			x: mat.FromRows([][]float64{
 				{.3, .5, -.1},
-				{1, 0, .4}},
-			h: &Head{
-				Q: mat.Mat{
+				{1, 0, .4}}),
+			h: &Head[float64]{
+				Q: mat.FromRows([][]float64{
 					{.2, 0},
 					{-.9, .85},
 					{1, .15},
-				},
-				K: mat.Mat{
+				}),
+				K: mat.FromRows([][]float64{
 					{.2, 0},
 					{-.9, .85},
 					{1, .15},
-				},
-				V: mat.Mat{
+				}),
+				V: mat.FromRows([][]float64{
 					{.2, 0},
 					{-.9, .85},
 					{1, .15},
-				},
+				}),
 				KLenSqrt: math.Sqrt(2.),
 			},
 
-			m: mat.Mat{
+			m: mat.FromRows([][]float64{
 				{0, 0},
 				{0, 0},
-			},
+			}),
 
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{-0.07312266339770607, 0.2761403047607313},
 				{0.17497425770462144, 0.19647615578291971},
-			},
+			}),
 		},
 	}
 
 	for i, test := range tests {
-		ans := test.h.Forward(test.x, test.m)
-		if !reflect.DeepEqual(ans, test.ans) {
+		test.h.Mask = test.m
+		ans := test.h.Forward(test.x)
+		if !ans.Equal(test.ans) {
 			t.Errorf("%d: %v != %v", i+1, ans, test.ans)
 		}
 	}
 }
+
+func Test_MultiHead_Allocs(t *testing.T) {
+	mat.SetWorkers(1)
+	defer mat.SetWorkers(0)
+
+	mh := NewMultiHead[float64](4, 6, 3, 2)
+	x := mat.New[float64](4, 6).Rand()
+	do := mat.New[float64](4, 6).Rand()
+
+	params := mh.Parameters()
+	step := func() {
+		mh.Forward(x)
+		mh.Backward(do)
+		nn.Step(params, .001)
+		nn.ZeroGrad(params)
+	}
+
+	step()
+
+	//остаётся только срез представлений из mat.Split
+	if n := testing.AllocsPerRun(10, step); n > 1 {
+		t.Errorf("%.1f выделений памяти на шаг", n)
+	}
+}
+
+func Test_Head_GradCheck(t *testing.T) {
+	h := NewHead[float64](4, 3)
+	h.Mask = CausalMask[float64](5)
+	x, r := mat.New[float64](5, 4).Rand(), mat.New[float64](5, 3).Rand()
+
+	loss := func() float64 {
+		return gradcheck.Dot(h.Forward(x), r)
+	}
+
+	backward := func() mat.Mat[float64] {
+		return h.Backward(r)
+	}
+
+	results := gradcheck.Params(loss, backward, h.Parameters(), &x)
+	if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+		t.Errorf("%s", gradcheck.Report(failed))
+	}
+}
+
+func Test_Head_Dropout_GradCheck(t *testing.T) {
+	defer nn.Train(nn.Train(true))
+
+	h := NewHead[float64](4, 3)
+	h.Mask = CausalMask[float64](5)
+	h.Drop, _ = dropout.New[float64](.3, 1)
+	x, r := mat.New[float64](5, 4).Rand(), mat.New[float64](5, 3).Rand()
+
+	//одна и та же маска при каждом вычислении ошибки
+	loss := func() float64 {
+		h.Drop.Reset()
+		return gradcheck.Dot(h.Forward(x), r)
+	}
+
+	backward := func() mat.Mat[float64] {
+		return h.Backward(r)
+	}
+
+	results := gradcheck.Params(loss, backward, h.Parameters(), &x)
+	if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+		t.Errorf("%s", gradcheck.Report(failed))
+	}
+
+	//при выводе dropout не действует
+	nn.Train(false)
+	ans := h.Forward(x).Clone()
+	h.Drop = nil
+	if res := h.Forward(x); !res.Equal(ans) {
+		t.Errorf("%v != %v", res.Slice(), ans.Slice())
+	}
+}
+
+func Test_MultiHead_GradCheck(t *testing.T) {
+	mh := NewMultiHead[float64](4, 6, 3, 2, initializer.XavierNormal)
+	x, r := mat.New[float64](4, 6).Rand(), mat.New[float64](4, 6).Rand()
+
+	loss := func() float64 {
+		return gradcheck.Dot(mh.Forward(x), r)
+	}
+
+	backward := func() mat.Mat[float64] {
+		return mh.Backward(r)
+	}
+
+	results := gradcheck.Params(loss, backward, mh.Parameters(), &x)
+	if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+		t.Errorf("%s", gradcheck.Report(failed))
+	}
+}
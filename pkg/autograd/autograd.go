@@ -0,0 +1,118 @@
+// Package autograd автоматическое дифференцирование в обратном режиме.
+// Операции над Var записываются на ленту Tape, Backward проходит ленту
+// в обратном порядке и накапливает градиенты всех параметров.
+// Так новые слои можно писать только через прямой проход,
+// а слои с ручным Backward остаются эталоном для сравнения.
+package autograd
+
+import (
+	"ml/pkg/mat"
+)
+
+// Tape лента операций одного прямого прохода
+type Tape[T mat.Float] struct {
+	vars []*Var[T]
+}
+
+func NewTape[T mat.Float]() *Tape[T] {
+	return &Tape[T]{}
+}
+
+// Var значение на ленте и его градиент
+type Var[T mat.Float] struct {
+	Value mat.Mat[T]
+	// Grad градиент по Value, пуст до Backward и у Var без градиента
+	Grad mat.Mat[T]
+
+	tape *Tape[T]
+	//needGrad зависит ли Var от параметров
+	needGrad bool
+	hasGrad  bool
+	//back передаёт градиент g аргументам операции
+	back func(g mat.Mat[T])
+}
+
+// Param добавляет на ленту параметр, по которому нужен градиент.
+// Value разделяет память с m.
+func (t *Tape[T]) Param(m mat.Mat[T]) *Var[T] {
+	return t.leaf(m, true)
+}
+
+// Const добавляет на ленту значение без градиента, например вход или маску
+func (t *Tape[T]) Const(m mat.Mat[T]) *Var[T] {
+	return t.leaf(m, false)
+}
+
+func (t *Tape[T]) leaf(m mat.Mat[T], needGrad bool) *Var[T] {
+	v := &Var[T]{Value: m, tape: t, needGrad: needGrad}
+	t.vars = append(t.vars, v)
+	return v
+}
+
+// node добавляет на ленту результат операции над args
+func (t *Tape[T]) node(value mat.Mat[T], back func(g mat.Mat[T]), args ...*Var[T]) *Var[T] {
+	v := &Var[T]{Value: value, tape: t}
+	for _, a := range args {
+		if a.tape != t {
+			panic("autograd: аргументы с разных лент")
+		}
+		v.needGrad = v.needGrad || a.needGrad
+	}
+	if v.needGrad {
+		v.back = back
+	}
+	t.vars = append(t.vars, v)
+	return v
+}
+
+func (v *Var[T]) accumulate(g mat.Mat[T]) {
+	if !v.needGrad {
+		return
+	}
+	if !v.hasGrad {
+		v.Grad, v.hasGrad = g.Clone(), true
+		return
+	}
+	v.Grad.AddInPlace(g)
+}
+
+// Backward вычисляет градиенты суммы элементов v по всем Var ленты,
+// записанным до v. Для скалярной ошибки это градиенты ошибки.
+func (v *Var[T]) Backward() {
+	ones := mat.New[T](v.Value.RowN(), v.Value.ColN())
+	v.BackwardFrom(ones.AddInPlace(mat.FromRows([][]T{{1}})))
+}
+
+// BackwardFrom то же, что Backward, с заданным градиентом do по v
+func (v *Var[T]) BackwardFrom(do mat.Mat[T]) {
+	v.accumulate(do)
+
+	vars := v.tape.vars
+	i := len(vars) - 1
+	for vars[i] != v {
+		i--
+	}
+
+	for ; i >= 0; i-- {
+		if n := vars[i]; n.back != nil && n.hasGrad {
+			n.back(n.Grad)
+		}
+	}
+}
+
+// reduce суммирует градиент g по измерениям, транслированным у аргумента rown x coln
+func reduce[T mat.Float](g mat.Mat[T], rown, coln int) mat.Mat[T] {
+	if g.RowN() != rown {
+		g = g.ColSum()
+	}
+	if g.ColN() != coln {
+		g = g.RowSum()
+	}
+	return g
+}
+
+func (v *Var[T]) accumulateReduced(g mat.Mat[T]) {
+	if v.needGrad {
+		v.accumulate(reduce(g, v.Value.RowN(), v.Value.ColN()))
+	}
+}
@@ -0,0 +1,231 @@
+package autograd
+
+import (
+	"math"
+	"math/rand/v2"
+	"ml/pkg/activation"
+	"ml/pkg/attention"
+	"ml/pkg/mat"
+	"ml/pkg/mlp"
+	"testing"
+)
+
+func randMat(rown, coln int) mat.Mat[float64] {
+	m := mat.New[float64](rown, coln)
+	for row := range rown {
+		for col := range coln {
+			m.Set(row, col, rand.Float64()*2-1)
+		}
+	}
+	return m
+}
+
+// check сравнивает градиенты f по params с конечными разностями.
+// Ошибка - взвешенная случайными r сумма элементов результата f.
+func check(t *testing.T, name string, params []mat.Mat[float64],
+	f func(tape *Tape[float64], ps []*Var[float64]) *Var[float64]) {
+	t.Helper()
+
+	var r mat.Mat[float64]
+	loss := func() (float64, []*Var[float64]) {
+		tape := NewTape[float64]()
+		ps := make([]*Var[float64], len(params))
+		for i, p := range params {
+			ps[i] = tape.Param(p)
+		}
+		out := f(tape, ps)
+		if r.RowN() == 0 {
+			r = randMat(out.Value.RowN(), out.Value.ColN())
+		}
+		l := out.Mul(tape.Const(r)).Sum()
+		return l.Value.At(0, 0), append(ps, l)
+	}
+
+	_, vars := loss()
+	vars[len(vars)-1].Backward()
+
+	const h = 1e-6
+	for i, p := range params {
+		grad := vars[i].Grad
+		for row := range p.RowN() {
+			for col := range p.ColN() {
+				v := p.At(row, col)
+				p.Set(row, col, v+h)
+				up, _ := loss()
+				p.Set(row, col, v-h)
+				down, _ := loss()
+				p.Set(row, col, v)
+
+				num := (up - down) / (2 * h)
+				if math.Abs(num-grad.At(row, col)) > 1e-6*max(1, math.Abs(num)) {
+					t.Errorf("%s: параметр %d (%d, %d) %v != %v",
+						name, i, row, col, grad.At(row, col), num)
+				}
+			}
+		}
+	}
+}
+
+func Test_Ops(t *testing.T) {
+	a, b := randMat(3, 4), randMat(3, 4)
+	row, col := randMat(1, 4), randMat(3, 1)
+	pos := randMat(3, 4).AddInPlace(mat.FromRows([][]float64{{2}}))
+	w := randMat(4, 2)
+
+	type fn = func(tape *Tape[float64], ps []*Var[float64]) *Var[float64]
+
+	tests := []struct {
+		name   string
+		params []mat.Mat[float64]
+		f      fn
+	}{
+		{"Add", []mat.Mat[float64]{a, b}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Add(ps[1])
+		}},
+		{"Add row", []mat.Mat[float64]{a, row}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Add(ps[1])
+		}},
+		{"Sub col", []mat.Mat[float64]{col, a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Sub(ps[1])
+		}},
+		{"Mul row col", []mat.Mat[float64]{row, col}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Mul(ps[1])
+		}},
+		{"Div", []mat.Mat[float64]{a, pos}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Div(ps[1])
+		}},
+		{"MatMul", []mat.Mat[float64]{a, w}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].MatMul(ps[1])
+		}},
+		{"MatMulT", []mat.Mat[float64]{a, b}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].MatMulT(ps[1])
+		}},
+		{"T Scale AddConst", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].T().Scale(-3).AddConst(1)
+		}},
+		{"Sqrt", []mat.Mat[float64]{pos}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Sqrt()
+		}},
+		{"Act", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Act(activation.GELU, 0)
+		}},
+		{"Softmax", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Softmax()
+		}},
+		{"RowMean", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].RowMean()
+		}},
+		{"Cols Concat", []mat.Mat[float64]{a, b}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return Concat(ps[1].Cols(1, 3), ps[0], ps[1].Cols(0, 1))
+		}},
+		{"Gather", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].Gather([]int{2, 0, 2})
+		}},
+		{"SoftmaxCrossEntropy", []mat.Mat[float64]{a}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return ps[0].SoftmaxCrossEntropy([]int{3, 0, 1})
+		}},
+		{"LayerNorm", []mat.Mat[float64]{a, row}, func(_ *Tape[float64], ps []*Var[float64]) *Var[float64] {
+			return layerNorm(ps[0], ps[1])
+		}},
+	}
+
+	for _, test := range tests {
+		check(t, test.name, test.params, test.f)
+	}
+}
+
+// layerNorm нормализация, записанная только прямым проходом
+func layerNorm(x, gamma *Var[float64]) *Var[float64] {
+	xc := x.Sub(x.RowMean())
+	std := xc.Mul(xc).RowMean().AddConst(1e-6).Sqrt()
+	return xc.Div(std).Mul(gamma)
+}
+
+func equalApprox(a, b mat.Mat[float64]) bool {
+	for row := range a.RowN() {
+		for col := range a.ColN() {
+			if math.Abs(a.At(row, col)-b.At(row, col)) > 1e-9 {
+				return false
+			}
+		}
+	}
+	return a.RowN() == b.RowN() && a.ColN() == b.ColN()
+}
+
+// сравнение с ручным mlp.MLP.Backward
+func Test_MLP(t *testing.T) {
+	m := mlp.New[float64](.1, 2, 3, 5, 4)
+	x, dans := randMat(2, 3), randMat(2, 4)
+
+	ans := m.Forward(x)
+	dlays := m.Grads(dans)
+
+	tape := NewTape[float64]()
+	out := tape.Const(x)
+	var ws, bs []*Var[float64]
+	for i, l := range m.Lays {
+		if i != 0 {
+			out = out.Act(activation.LeakyReLU, m.Alpha)
+		}
+		ws, bs = append(ws, tape.Param(l.Weight)), append(bs, tape.Param(l.Bias))
+		out = out.MatMul(ws[i]).Add(bs[i])
+	}
+
+	if !equalApprox(out.Value, ans) {
+		t.Fatalf("%v != %v", out.Value.Slice(), ans.Slice())
+	}
+
+	out.BackwardFrom(dans)
+
+	for i, dlay := range dlays {
+		if !equalApprox(ws[i].Grad, dlay.Weight) || !equalApprox(bs[i].Grad, dlay.Bias) {
+			t.Errorf("%d: %v != %v", i, ws[i].Grad.Slice(), dlay.Weight.Slice())
+		}
+	}
+}
+
+// сравнение с ручным attention.Head.Backward
+func Test_Head(t *testing.T) {
+	h := attention.NewHead[float64](4, 3)
+	mask := attention.CausalMask[float64](5)
+	x, do := randMat(5, 4), randMat(5, 3)
+
+	tape := NewTape[float64]()
+	xv, q, k, v := tape.Param(x), tape.Param(h.Q.Clone()), tape.Param(h.K.Clone()), tape.Param(h.V.Clone())
+	out := xv.MatMul(q).MatMulT(xv.MatMul(k)).
+		Scale(1 / h.KLenSqrt).
+		Add(tape.Const(mask)).
+		Softmax().
+		MatMul(xv.MatMul(v))
+
+	h.Mask = mask
+	ans := h.Forward(x)
+	if !equalApprox(out.Value, ans) {
+		t.Fatalf("%v != %v", out.Value.Slice(), ans.Slice())
+	}
+
+	out.BackwardFrom(do)
+
+	dx := h.Backward(do)
+	for i, p := range h.Parameters() {
+		vars := []*Var[float64]{q, k, v}
+		if !equalApprox(*p.Grad, vars[i].Grad) {
+			t.Errorf("%s: %v != %v", p.Name, p.Grad.Slice(), vars[i].Grad.Slice())
+		}
+	}
+	if !equalApprox(dx, xv.Grad) {
+		t.Errorf("dx: %v != %v", dx.Slice(), xv.Grad.Slice())
+	}
+}
+
+func Test_Const(t *testing.T) {
+	tape := NewTape[float64]()
+	c := tape.Const(randMat(2, 2))
+	p := tape.Param(randMat(2, 2))
+
+	c.Mul(c).Add(p).Sum().Backward()
+
+	if c.Grad.RowN() != 0 || !p.Grad.Equal(mat.FromRows([][]float64{{1, 1}, {1, 1}})) {
+		t.Errorf("%v %v", c.Grad.Slice(), p.Grad.Slice())
+	}
+}
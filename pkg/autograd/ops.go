@@ -0,0 +1,174 @@
+package autograd
+
+import (
+	"math"
+	"ml/pkg/activation"
+	"ml/pkg/mat"
+)
+
+// Add, Sub, Mul и Div транслируют строки и столбцы так же, как mat
+
+func (a *Var[T]) Add(b *Var[T]) *Var[T] {
+	return a.tape.node(a.Value.Add(b.Value), func(g mat.Mat[T]) {
+		a.accumulateReduced(g)
+		b.accumulateReduced(g)
+	}, a, b)
+}
+
+func (a *Var[T]) Sub(b *Var[T]) *Var[T] {
+	return a.tape.node(a.Value.Sub(b.Value), func(g mat.Mat[T]) {
+		a.accumulateReduced(g)
+		b.accumulateReduced(g.Scale(-1))
+	}, a, b)
+}
+
+// Mul поэлементное произведение
+func (a *Var[T]) Mul(b *Var[T]) *Var[T] {
+	return a.tape.node(a.Value.MulElwise(b.Value), func(g mat.Mat[T]) {
+		a.accumulateReduced(g.MulElwise(b.Value))
+		b.accumulateReduced(g.MulElwise(a.Value))
+	}, a, b)
+}
+
+func (a *Var[T]) Div(b *Var[T]) *Var[T] {
+	value := a.Value.Div(b.Value)
+	return a.tape.node(value, func(g mat.Mat[T]) {
+		a.accumulateReduced(g.Div(b.Value))
+		//d(a/b)/db = -(a/b)/b
+		b.accumulateReduced(g.MulElwise(value).Div(b.Value).Scale(-1))
+	}, a, b)
+}
+
+// MatMul матричное произведение a * b
+func (a *Var[T]) MatMul(b *Var[T]) *Var[T] {
+	return a.tape.node(a.Value.Mul(b.Value), func(g mat.Mat[T]) {
+		a.accumulate(g.MulT(b.Value))
+		b.accumulate(a.Value.TMul(g))
+	}, a, b)
+}
+
+// MatMulT произведение a * bT
+func (a *Var[T]) MatMulT(b *Var[T]) *Var[T] {
+	return a.tape.node(a.Value.MulT(b.Value), func(g mat.Mat[T]) {
+		a.accumulate(g.Mul(b.Value))
+		b.accumulate(g.TMul(a.Value))
+	}, a, b)
+}
+
+func (a *Var[T]) T() *Var[T] {
+	return a.tape.node(a.Value.T(), func(g mat.Mat[T]) {
+		a.accumulate(g.T())
+	}, a)
+}
+
+func (a *Var[T]) Scale(n float64) *Var[T] {
+	return a.tape.node(a.Value.Scale(T(n)), func(g mat.Mat[T]) {
+		a.accumulate(g.Scale(T(n)))
+	}, a)
+}
+
+// AddConst прибавляет n к каждому элементу
+func (a *Var[T]) AddConst(n float64) *Var[T] {
+	return a.tape.node(a.Value.Add(mat.FromRows([][]T{{T(n)}})), func(g mat.Mat[T]) {
+		a.accumulate(g)
+	}, a)
+}
+
+func (a *Var[T]) Sqrt() *Var[T] {
+	value := apply(a.Value, math.Sqrt)
+	return a.tape.node(value, func(g mat.Mat[T]) {
+		a.accumulate(g.Div(value).Scale(.5))
+	}, a)
+}
+
+// Act применяет функцию активации name с параметром alpha
+func (a *Var[T]) Act(name activation.Name, alpha float64) *Var[T] {
+	return a.tape.node(activation.Forward(name, a.Value, alpha), func(g mat.Mat[T]) {
+		a.accumulate(g.MulElwise(activation.Der(name, a.Value, alpha)))
+	}, a)
+}
+
+// Softmax каждой строки
+func (a *Var[T]) Softmax() *Var[T] {
+	s := a.Value.Softmax()
+	return a.tape.node(s, func(g mat.Mat[T]) {
+		gs := g.MulElwise(s)
+		a.accumulate(s.MulElwise(g.Sub(gs.RowSum())))
+	}, a)
+}
+
+// RowMean среднее каждой строки, столбец RowN() x 1
+func (a *Var[T]) RowMean() *Var[T] {
+	return a.tape.node(a.Value.Mean(), func(g mat.Mat[T]) {
+		da := mat.New[T](a.Value.RowN(), a.Value.ColN())
+		a.accumulate(da.AddInPlace(g.Scale(T(1 / float64(a.Value.ColN())))))
+	}, a)
+}
+
+// Sum сумма всех элементов, матрица 1 x 1
+func (a *Var[T]) Sum() *Var[T] {
+	var sum float64
+	for row := range a.Value.RowN() {
+		for _, v := range a.Value.Row(row) {
+			sum += float64(v)
+		}
+	}
+
+	return a.tape.node(mat.FromRows([][]T{{T(sum)}}), func(g mat.Mat[T]) {
+		da := mat.New[T](a.Value.RowN(), a.Value.ColN())
+		a.accumulate(da.AddInPlace(g))
+	}, a)
+}
+
+// Cols столбцы [from, to)
+func (a *Var[T]) Cols(from, to int) *Var[T] {
+	return a.tape.node(a.Value.Cols(from, to).Clone(), func(g mat.Mat[T]) {
+		da := mat.New[T](a.Value.RowN(), a.Value.ColN())
+		da.Cols(from, to).Copy(g)
+		a.accumulate(da)
+	}, a)
+}
+
+// Gather строки a с номерами ids, как в embedding.Embedding
+func (a *Var[T]) Gather(ids []int) *Var[T] {
+	return a.tape.node(a.Value.Gather(ids), func(g mat.Mat[T]) {
+		da := mat.New[T](a.Value.RowN(), a.Value.ColN())
+		a.accumulate(da.ScatterAdd(g, ids))
+	}, a)
+}
+
+// SoftmaxCrossEntropy средняя по строкам ошибка mat.SoftmaxCrossEntropy, матрица 1 x 1
+func (a *Var[T]) SoftmaxCrossEntropy(targets []int) *Var[T] {
+	loss, grad := mat.SoftmaxCrossEntropyGrad(a.Value, targets)
+	return a.tape.node(mat.FromRows([][]T{{T(loss)}}), func(g mat.Mat[T]) {
+		a.accumulate(grad.Scale(g.At(0, 0) / T(a.Value.RowN())))
+	}, a)
+}
+
+// Concat объединяет столбцы vars
+func Concat[T mat.Float](vars ...*Var[T]) *Var[T] {
+	values := make([]mat.Mat[T], len(vars))
+	for i, v := range vars {
+		values[i] = v.Value
+	}
+
+	return vars[0].tape.node(mat.Concat(values...), func(g mat.Mat[T]) {
+		var from int
+		for _, v := range vars {
+			to := from + v.Value.ColN()
+			v.accumulate(g.Cols(from, to).Clone())
+			from = to
+		}
+	}, vars...)
+}
+
+func apply[T mat.Float](m mat.Mat[T], f func(float64) float64) mat.Mat[T] {
+	ans := mat.New[T](m.RowN(), m.ColN())
+	for row := range m.RowN() {
+		ansrow := ans.Row(row)
+		for col, v := range m.Row(row) {
+			ansrow[col] = T(f(float64(v)))
+		}
+	}
+	return ans
+}
@@ -0,0 +1,102 @@
+// Package dropout случайное обнуление выходов слоёв при обучении
+package dropout
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// Dropout в режиме обучения nn.Training обнуляет каждый элемент с вероятностью Rate,
+// а остальные делит на 1-Rate, поэтому при выводе ничего не меняет.
+// Маски берутся из генератора с начальным значением Seed и повторяются от запуска к запуску.
+// nil Dropout ничего не делает, так слои обходятся без проверок.
+type Dropout[T mat.Float] struct {
+	Rate float64 `json:"rate"`
+	Seed uint64  `json:"seed"`
+
+	rng *rand.Rand
+	//active последний Forward обнулял элементы по mask
+	active        bool
+	mask, ans, dx mat.Mat[T]
+}
+
+var _ nn.Module[float64] = (*Dropout[float64])(nil)
+
+// New создаёт Dropout с вероятностью rate из [0, 1)
+func New[T mat.Float](rate float64, seed uint64) (*Dropout[T], error) {
+	if err := Check(rate); err != nil {
+		return nil, err
+	}
+	return &Dropout[T]{Rate: rate, Seed: seed}, nil
+}
+
+// Check проверяет вероятность: при rate >= 1 множитель 1/(1-rate) бесконечен или отрицателен
+func Check(rate float64) error {
+	if !(rate >= 0 && rate < 1) {
+		return fmt.Errorf("dropout: вероятность %v вне [0, 1)", rate)
+	}
+	return nil
+}
+
+// UnmarshalJSON отклоняет сохранённую вероятность вне [0, 1)
+func (d *Dropout[T]) UnmarshalJSON(data []byte) error {
+	type drop Dropout[T]
+	if err := json.Unmarshal(data, (*drop)(d)); err != nil {
+		return err
+	}
+	return Check(d.Rate)
+}
+
+// Reset начинает маски заново с Seed
+func (d *Dropout[T]) Reset() {
+	if d != nil {
+		d.rng = nil
+	}
+}
+
+func (d *Dropout[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	if d == nil {
+		return x
+	}
+	d.active = d.Rate > 0 && nn.Training()
+	if !d.active {
+		return x
+	}
+
+	if d.rng == nil {
+		d.rng = rand.New(rand.NewPCG(d.Seed, d.Seed))
+	}
+
+	scale := T(1 / (1 - d.Rate))
+	d.mask = mat.Reuse(d.mask, x.RowN(), x.ColN())
+	for row := range d.mask.RowN() {
+		mask := d.mask.Row(row)
+		for col := range mask {
+			mask[col] = scale
+			if d.rng.Float64() < d.Rate {
+				mask[col] = 0
+			}
+		}
+	}
+
+	d.ans = x.MulElwiseTo(mat.Reuse(d.ans, x.RowN(), x.ColN()), d.mask)
+	return d.ans
+}
+
+// Backward пропускает градиент через ту же маску, что и последний Forward
+func (d *Dropout[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	if d == nil || !d.active {
+		return do
+	}
+
+	d.dx = do.MulElwiseTo(mat.Reuse(d.dx, do.RowN(), do.ColN()), d.mask)
+	return d.dx
+}
+
+// Parameters у Dropout нет обучаемых матриц
+func (d *Dropout[T]) Parameters() []*nn.Param[T] {
+	return nil
+}
@@ -0,0 +1,109 @@
+package dropout
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"testing"
+)
+
+func ones(rown, coln int) mat.Mat[float64] {
+	return mat.New[float64](rown, coln).AddInPlace(mat.FromRows([][]float64{{1}}))
+}
+
+func must(d *Dropout[float64], err error) *Dropout[float64] {
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func Test_New(t *testing.T) {
+	tests := []struct {
+		rate float64
+		ok   bool
+	}{
+		{0, true},
+		{.5, true},
+		{.999, true},
+		{1, false},
+		{1.5, false},
+		{-.1, false},
+		{math.NaN(), false},
+	}
+
+	for i, test := range tests {
+		_, err := New[float64](test.rate, 1)
+		if (err == nil) != test.ok {
+			t.Errorf("%d: %v: %v", i+1, test.rate, err)
+		}
+
+		//сохранённая вероятность проверяется при загрузке
+		var d Dropout[float64]
+		err = json.Unmarshal([]byte(fmt.Sprintf(`{"rate":%v,"seed":1}`, test.rate)), &d)
+		if test.ok && (err != nil || d.Rate != test.rate) || !test.ok && err == nil {
+			t.Errorf("%d: json %v: %v", i+1, test.rate, err)
+		}
+	}
+}
+
+func Test_Dropout_Eval(t *testing.T) {
+	tests := []*Dropout[float64]{nil, must(New[float64](.5, 1)), must(New[float64](0, 1))}
+
+	x := ones(2, 3)
+	for i, d := range tests {
+		if ans := d.Forward(x); !ans.Equal(x) {
+			t.Errorf("%d: %v", i+1, ans.Slice())
+		}
+		if dx := d.Backward(x); !dx.Equal(x) {
+			t.Errorf("%d: %v", i+1, dx.Slice())
+		}
+	}
+}
+
+func Test_Dropout_Train(t *testing.T) {
+	defer nn.Train(nn.Train(true))
+
+	const rate = .25
+	x, do := ones(100, 100), mat.New[float64](100, 100).Rand()
+
+	d := must(New[float64](rate, 7))
+	ans := d.Forward(x).Clone()
+	dx := d.Backward(do)
+
+	var zeros int
+	for row := range ans.RowN() {
+		for col := range ans.ColN() {
+			switch v := ans.At(row, col); v {
+			case 0:
+				zeros++
+				if dx.At(row, col) != 0 {
+					t.Fatalf("%d %d: %v", row, col, dx.At(row, col))
+				}
+			case 1 / (1 - rate):
+				if dx.At(row, col) != do.At(row, col)*v {
+					t.Fatalf("%d %d: %v", row, col, dx.At(row, col))
+				}
+			default:
+				t.Fatalf("%d %d: %v", row, col, v)
+			}
+		}
+	}
+	if frac := float64(zeros) / 1e4; math.Abs(frac-rate) > .02 {
+		t.Errorf("%v != %v", frac, rate)
+	}
+
+	//та же маска после Reset и у другого Dropout с тем же Seed
+	d.Reset()
+	if res := d.Forward(x); !res.Equal(ans) {
+		t.Error("маска после Reset отличается")
+	}
+	if res := must(New[float64](rate, 7)).Forward(x); !res.Equal(ans) {
+		t.Error("маска с тем же Seed отличается")
+	}
+	if res := must(New[float64](rate, 8)).Forward(x); res.Equal(ans) {
+		t.Error("маски с разным Seed совпадают")
+	}
+}
@@ -0,0 +1,66 @@
+// Package embedding слой, заменяющий номера токенов их векторами
+package embedding
+
+import (
+	"encoding/json"
+	"ml/pkg/initializer"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// Embedding хранит вектор каждого токена в строке W.
+// Forward выбирает строки по номерам вместо умножения матрицы one-hot на W.
+type Embedding[T mat.Float] struct {
+	W mat.Mat[T]
+
+	ids []int
+	ans mat.Mat[T]
+	//dw накопленный градиент по W, ненулевые только строки rows
+	dw   mat.Mat[T]
+	rows []int
+}
+
+var _ nn.Trainable[float64] = (*Embedding[float64])(nil)
+
+// New создаёт таблицу векторов n x dim.
+// Необязательный init заполняет W, по умолчанию initializer.HeNormal.
+func New[T mat.Float](n, dim int, init ...initializer.Init) *Embedding[T] {
+	return &Embedding[T]{
+		W: initializer.New[T](n, dim, initializer.Pick(init, initializer.HeNormal)),
+	}
+}
+
+// Forward возвращает матрицу len(ids) x dim из векторов токенов ids
+func (e *Embedding[T]) Forward(ids []int) mat.Mat[T] {
+	e.ids = ids
+	e.ans = e.W.GatherTo(mat.Reuse(e.ans, len(ids), e.W.ColN()), ids)
+	return e.ans
+}
+
+// BackwardTo прибавляет к dw градиент по W: строки do
+// складываются в строки dw с номерами токенов последнего Forward
+func (e *Embedding[T]) BackwardTo(dw, do mat.Mat[T]) mat.Mat[T] {
+	return dw.ScatterAdd(do, e.ids)
+}
+
+// Backward прибавляет градиент по do ответа Forward
+// только к строкам токенов последнего Forward, nn.Step меняет только эти строки W
+func (e *Embedding[T]) Backward(do mat.Mat[T]) {
+	e.dw = mat.Reuse(e.dw, e.W.RowN(), e.W.ColN())
+	e.BackwardTo(e.dw, do)
+	nn.AccumulateRows(&e.rows, e.ids)
+}
+
+// Parameters градиент W разреженный: Rows - номера токенов после последнего nn.ZeroGrad
+func (e *Embedding[T]) Parameters() []*nn.Param[T] {
+	return []*nn.Param[T]{{Name: "weight", Value: &e.W, Grad: &e.dw, Rows: &e.rows}}
+}
+
+// MarshalJSON сохраняет только W, как прежнее поле embs моделей
+func (e *Embedding[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.W)
+}
+
+func (e *Embedding[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.W)
+}
@@ -0,0 +1,78 @@
+package embedding
+
+import (
+	"encoding/json"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"slices"
+	"testing"
+)
+
+func Test_Embedding(t *testing.T) {
+	const n, dim = 7, 3
+
+	e := New[float64](n, dim)
+	w := e.W.Clone()
+	ids := []int{4, 0, 4, 6}
+
+	oneHot := mat.New[float64](len(ids), n)
+	oneHot.OneHot(ids)
+
+	if ans := e.Forward(ids); !ans.Equal(oneHot.Mul(w)) {
+		t.Errorf("%v != %v", ans.Slice(), oneHot.Mul(w).Slice())
+	}
+
+	//повторяющийся токен 4 получает сумму градиентов, остальные строки не меняются
+	do := mat.New[float64](len(ids), dim).Rand()
+	e.Backward(do)
+	nn.Step(e.Parameters(), .5)
+
+	want := w.Sub(oneHot.TMul(do).Scale(.5))
+	for row := range n {
+		for col := range dim {
+			if math.Abs(e.W.At(row, col)-want.At(row, col)) > 1e-12 {
+				t.Errorf("(%d, %d) %v != %v", row, col, e.W.At(row, col), want.At(row, col))
+			}
+		}
+	}
+	for _, row := range []int{1, 2, 3, 5} {
+		if !e.W.Rows(row, row+1).Equal(w.Rows(row, row+1)) {
+			t.Errorf("строка %d изменилась", row)
+		}
+	}
+
+	p := e.Parameters()[0]
+	if !slices.Equal(*p.Rows, []int{0, 4, 6}) || !p.Grad.Equal(mat.New[float64](n, dim).ScatterAdd(do, ids)) {
+		t.Errorf("%v %v", *p.Rows, p.Grad.Slice())
+	}
+
+	//второй проход накапливает градиент и строки
+	e.Forward([]int{1})
+	e.Backward(do.Rows(0, 1))
+	if !slices.Equal(*p.Rows, []int{0, 1, 4, 6}) || !p.Grad.Rows(1, 2).Equal(do.Rows(0, 1)) {
+		t.Errorf("%v %v", *p.Rows, p.Grad.Slice())
+	}
+
+	nn.ZeroGrad(e.Parameters())
+	if len(*p.Rows) != 0 || !p.Grad.Equal(mat.New[float64](n, dim)) {
+		t.Errorf("%v %v", *p.Rows, p.Grad.Slice())
+	}
+}
+
+func Test_Embedding_JSON(t *testing.T) {
+	e := Embedding[float64]{W: mat.FromRows([][]float64{{1, 2}, {3, 4}})}
+
+	data, err := json.Marshal(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[[1,2],[3,4]]" {
+		t.Errorf("%s", data)
+	}
+
+	var loaded Embedding[float64]
+	if err = json.Unmarshal(data, &loaded); err != nil || !loaded.W.Equal(e.W) {
+		t.Errorf("%v %v", err, loaded.W.Slice())
+	}
+}
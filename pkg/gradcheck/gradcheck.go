@@ -0,0 +1,129 @@
+// Package gradcheck проверка аналитических градиентов конечными разностями
+package gradcheck
+
+import (
+	"fmt"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"strings"
+)
+
+// Eps шаг центральной разности
+const Eps = 1e-6
+
+// Result отличие аналитического градиента одной матрицы от численного
+type Result struct {
+	Name string
+	// RelErr |a - n| / (|a| + |n|) по норме Фробениуса
+	RelErr float64
+	// MaxAbs наибольшее отличие одного элемента
+	MaxAbs float64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: отн. ошибка %.2e, макс. отличие %.2e", r.Name, r.RelErr, r.MaxAbs)
+}
+
+// Check изменяет каждый элемент каждой матрицы tensors на ±Eps,
+// вычисляет loss и сравнивает численную производную с grads[имя].
+// Значения матриц после проверки не меняются.
+func Check(loss func() float64, tensors []mat.Tensor[float64], grads map[string]mat.Mat[float64]) []Result {
+	results := make([]Result, 0, len(tensors))
+
+	for _, t := range tensors {
+		grad, ok := grads[t.Name]
+		if !ok {
+			panic(fmt.Sprintf("gradcheck: нет градиента %s", t.Name))
+		}
+		m := *t.Mat
+		if grad.RowN() != m.RowN() || grad.ColN() != m.ColN() {
+			panic(&mat.ShapeError{Op: "gradcheck " + t.Name,
+				A: [2]int{m.RowN(), m.ColN()}, B: [2]int{grad.RowN(), grad.ColN()}})
+		}
+
+		var diff, norm, maxAbs float64
+		for row := range m.RowN() {
+			for col := range m.ColN() {
+				v := m.At(row, col)
+				m.Set(row, col, v+Eps)
+				up := loss()
+				m.Set(row, col, v-Eps)
+				down := loss()
+				m.Set(row, col, v)
+
+				num, a := (up-down)/(2*Eps), grad.At(row, col)
+				diff += (a - num) * (a - num)
+				norm += a*a + num*num
+				maxAbs = max(maxAbs, math.Abs(a-num))
+			}
+		}
+
+		r := Result{Name: t.Name, MaxAbs: maxAbs}
+		if norm != 0 {
+			r.RelErr = math.Sqrt(diff) / math.Sqrt(norm)
+		}
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// Params проверяет накопленные градиенты params и градиент по входу x.
+// loss вычисляет ошибку прямым проходом, backward после loss делает обратный проход
+// и возвращает градиент ошибки по x. Если x nil, вход не проверяется.
+func Params(loss func() float64, backward func() mat.Mat[float64], params []*nn.Param[float64], x *mat.Mat[float64]) []Result {
+	nn.ZeroGrad(params)
+	loss()
+	dx := backward()
+
+	tensors, grads := nn.Tensors(params), Grads(params)
+	if x != nil {
+		tensors = append(tensors, mat.Tensor[float64]{Name: "x", Mat: x})
+		grads["x"] = dx.Clone()
+	}
+
+	return Check(loss, tensors, grads)
+}
+
+// Failed возвращает результаты с относительной ошибкой больше tol
+func Failed(results []Result, tol float64) []Result {
+	var failed []Result
+	for _, r := range results {
+		if !(r.RelErr <= tol) {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Report одна строка на каждую матрицу
+func Report(results []Result) string {
+	var sb strings.Builder
+	for _, r := range results {
+		sb.WriteString(r.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Dot сумма произведений элементов out и r.
+// Удобная ошибка для проверки слоя: её градиент по out равен r.
+func Dot(out, r mat.Mat[float64]) float64 {
+	var sum float64
+	for row := range out.RowN() {
+		for col := range out.ColN() {
+			sum += out.At(row, col) * r.At(row, col)
+		}
+	}
+	return sum
+}
+
+// Grads копирует накопленные градиенты params под их именами
+func Grads(params []*nn.Param[float64]) map[string]mat.Mat[float64] {
+	grads := make(map[string]mat.Mat[float64], len(params))
+	for _, p := range params {
+		grads[p.Name] = p.Grad.Clone()
+	}
+	return grads
+}
@@ -0,0 +1,85 @@
+package gradcheck
+
+import (
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"slices"
+	"testing"
+)
+
+func Test_Check(t *testing.T) {
+	w := mat.FromRows([][]float64{{1, -2}, {.5, 3}})
+	x := mat.FromRows([][]float64{{2, 1}})
+
+	//loss = sum(w * w) + x[0][0]^3
+	loss := func() float64 {
+		return Dot(w, w) + x.At(0, 0)*x.At(0, 0)*x.At(0, 0)
+	}
+
+	tensors := []mat.Tensor[float64]{{Name: "w", Mat: &w}, {Name: "x", Mat: &x}}
+
+	results := Check(loss, tensors, map[string]mat.Mat[float64]{
+		"w": w.Scale(2),
+		"x": mat.FromRows([][]float64{{12, 0}}),
+	})
+	if failed := Failed(results, 1e-8); len(failed) != 0 {
+		t.Errorf("%s", Report(failed))
+	}
+
+	//неверный градиент x
+	results = Check(loss, tensors, map[string]mat.Mat[float64]{
+		"w": w.Scale(2),
+		"x": mat.FromRows([][]float64{{12, 1}}),
+	})
+	if failed := Failed(results, 1e-8); len(failed) != 1 || failed[0].Name != "x" {
+		t.Errorf("%s", Report(results))
+	}
+
+	if !w.Equal(mat.FromRows([][]float64{{1, -2}, {.5, 3}})) {
+		t.Errorf("значения изменились: %v", w.Slice())
+	}
+}
+
+func Test_Params(t *testing.T) {
+	w, x, r := mat.New[float64](3, 2).Rand(), mat.New[float64](4, 3).Rand(), mat.New[float64](4, 2).Rand()
+	var dw mat.Mat[float64]
+	params := []*nn.Param[float64]{{Name: "w", Value: &w, Grad: &dw}}
+
+	tests := []struct {
+		//scale множитель градиента по x, при 1 градиенты верные
+		scale  float64
+		failed []string
+	}{
+		{1, nil},
+		{2, []string{"x"}},
+	}
+
+	for i, test := range tests {
+		//loss = sum(r * xw)
+		loss := func() float64 {
+			return Dot(x.Mul(w), r)
+		}
+		backward := func() mat.Mat[float64] {
+			nn.Accumulate(&dw, x.TMul(r))
+			return r.MulT(w).Scale(test.scale)
+		}
+
+		var names []string
+		for _, f := range Failed(Params(loss, backward, params, &x), 1e-6) {
+			names = append(names, f.Name)
+		}
+		if !slices.Equal(names, test.failed) {
+			t.Errorf("%d: %v != %v", i+1, names, test.failed)
+		}
+	}
+}
+
+func Test_Grads(t *testing.T) {
+	w, dw := mat.FromRows([][]float64{{1, 2}}), mat.FromRows([][]float64{{.5, -4}})
+	grads := Grads([]*nn.Param[float64]{{Name: "w", Value: &w, Grad: &dw}})
+
+	dw.Set(0, 0, 1)
+	if !grads["w"].Equal(mat.FromRows([][]float64{{.5, -4}})) {
+		t.Errorf("%v", grads["w"].Slice())
+	}
+}
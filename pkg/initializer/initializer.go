@@ -0,0 +1,134 @@
+// Package initializer способы начального заполнения весов.
+// Пакет не называется init, так как такое имя нельзя импортировать.
+package initializer
+
+import (
+	"math"
+	"math/rand/v2"
+	"ml/pkg/mat"
+)
+
+// Init заполняет data - матрицу rown x coln, хранящуюся по строкам.
+// Для весов, на которые умножается вход x * W, rown - число входов (fan in),
+// coln - число выходов (fan out).
+type Init func(data []float64, rown, coln int)
+
+// Apply заполняет m с помощью init и возвращает m
+func Apply[T mat.Float](m mat.Mat[T], init Init) mat.Mat[T] {
+	data := make([]float64, m.RowN()*m.ColN())
+	init(data, m.RowN(), m.ColN())
+
+	for row := range m.RowN() {
+		for col := range m.ColN() {
+			m.Set(row, col, T(data[row*m.ColN()+col]))
+		}
+	}
+
+	return m
+}
+
+// New создаёт матрицу rown x coln и заполняет её с помощью init
+func New[T mat.Float](rown, coln int, init Init) mat.Mat[T] {
+	return Apply(mat.New[T](rown, coln), init)
+}
+
+// HeNormal нормальное распределение со std = sqrt(2/rown), как в mat.Rand
+func HeNormal(data []float64, rown, coln int) {
+	normal(data, math.Sqrt(2./float64(rown)))
+}
+
+// XavierUniform равномерное распределение на [-a, a], a = sqrt(6/(rown+coln))
+func XavierUniform(data []float64, rown, coln int) {
+	a := math.Sqrt(6. / float64(rown+coln))
+	for i := range data {
+		data[i] = (rand.Float64()*2 - 1) * a
+	}
+}
+
+// XavierNormal нормальное распределение со std = sqrt(2/(rown+coln))
+func XavierNormal(data []float64, rown, coln int) {
+	normal(data, math.Sqrt(2./float64(rown+coln)))
+}
+
+// TruncNormal нормальное распределение со стандартным отклонением std,
+// значения дальше 2*std выбираются заново. В GPT используется std = 0.02.
+func TruncNormal(std float64) Init {
+	return func(data []float64, _, _ int) {
+		for i := range data {
+			v := rand.NormFloat64()
+			for math.Abs(v) > 2 {
+				v = rand.NormFloat64()
+			}
+			data[i] = v * std
+		}
+	}
+}
+
+// Orthogonal ортогональная матрица, умноженная на gain.
+// При rown >= coln ортонормированы столбцы, иначе строки.
+func Orthogonal(gain float64) Init {
+	return func(data []float64, rown, coln int) {
+		//q хранит векторы, которые нужно ортонормировать, подряд
+		n, m := max(rown, coln), min(rown, coln)
+		q := make([]float64, n*m)
+		normal(q, 1)
+
+		//модифицированный процесс Грама-Шмидта
+		for i := range m {
+			v := q[i*n : (i+1)*n]
+			for j := range i {
+				u := q[j*n : (j+1)*n]
+				dot := 0.
+				for k := range v {
+					dot += v[k] * u[k]
+				}
+				for k := range v {
+					v[k] -= dot * u[k]
+				}
+			}
+
+			norm := 0.
+			for _, x := range v {
+				norm += x * x
+			}
+			norm = math.Sqrt(norm)
+			for k := range v {
+				v[k] /= norm
+			}
+		}
+
+		for row := range rown {
+			for col := range coln {
+				if rown >= coln {
+					data[row*coln+col] = gain * q[col*n+row]
+				} else {
+					data[row*coln+col] = gain * q[row*n+col]
+				}
+			}
+		}
+	}
+}
+
+func Zeros(data []float64, _, _ int) {
+	clear(data)
+}
+
+func Ones(data []float64, _, _ int) {
+	for i := range data {
+		data[i] = 1
+	}
+}
+
+func normal(data []float64, std float64) {
+	for i := range data {
+		data[i] = rand.NormFloat64() * std
+	}
+}
+
+// Pick возвращает первый из необязательных inits конструктора или def
+func Pick(inits []Init, def Init) Init {
+	if len(inits) != 0 && inits[0] != nil {
+		return inits[0]
+	}
+	return def
+}
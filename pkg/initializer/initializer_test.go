@@ -0,0 +1,113 @@
+package initializer
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"testing"
+)
+
+func stats(data []float64) (mean, std float64) {
+	for _, v := range data {
+		mean += v
+	}
+	mean /= float64(len(data))
+
+	for _, v := range data {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(data)))
+}
+
+func Test_Distributions(t *testing.T) {
+	const rown, coln = 200, 300
+
+	tests := []struct {
+		init  Init
+		std   float64
+		bound float64
+	}{
+		{init: HeNormal, std: math.Sqrt(2. / rown)},
+		{init: XavierNormal, std: math.Sqrt(2. / (rown + coln))},
+		{
+			init:  XavierUniform,
+			std:   math.Sqrt(6./(rown+coln)) / math.Sqrt(3),
+			bound: math.Sqrt(6. / (rown + coln)),
+		},
+		//усечение на 2 std уменьшает отклонение до 0.88 std
+		{init: TruncNormal(.02), std: .02 * .8796, bound: .04},
+	}
+
+	for i, test := range tests {
+		data := make([]float64, rown*coln)
+		test.init(data, rown, coln)
+
+		mean, std := stats(data)
+		if math.Abs(mean) > test.std/20 || math.Abs(std-test.std) > test.std/20 {
+			t.Errorf("%d: mean %v, std %v != %v", i+1, mean, std, test.std)
+		}
+
+		if test.bound == 0 {
+			continue
+		}
+		for _, v := range data {
+			if math.Abs(v) > test.bound {
+				t.Errorf("%d: %v вне [-%v, %v]", i+1, v, test.bound, test.bound)
+				break
+			}
+		}
+	}
+}
+
+func Test_Orthogonal(t *testing.T) {
+	tests := [][2]int{{8, 5}, {5, 8}, {6, 6}}
+
+	for i, test := range tests {
+		m := New[float64](test[0], test[1], Orthogonal(2))
+
+		//произведение с меньшей стороны равно gain^2 * I
+		var prod mat.Mat[float64]
+		if test[0] >= test[1] {
+			prod = m.TMul(m)
+		} else {
+			prod = m.MulT(m)
+		}
+
+		for row := range prod.RowN() {
+			for col := range prod.ColN() {
+				want := 0.
+				if row == col {
+					want = 4
+				}
+				if math.Abs(prod.At(row, col)-want) > 1e-9 {
+					t.Errorf("%d: (%d, %d) %v != %v", i+1, row, col, prod.At(row, col), want)
+				}
+			}
+		}
+	}
+}
+
+func Test_Const(t *testing.T) {
+	m := New[float32](2, 3, Ones)
+	if !m.Equal(mat.FromRows([][]float32{{1, 1, 1}, {1, 1, 1}})) {
+		t.Errorf("%v", m.Slice())
+	}
+
+	Apply(m, Zeros)
+	if !m.Equal(mat.New[float32](2, 3)) {
+		t.Errorf("%v", m.Slice())
+	}
+}
+
+func Test_Pick(t *testing.T) {
+	data := make([]float64, 1)
+
+	Pick(nil, Ones)(data, 1, 1)
+	if data[0] != 1 {
+		t.Errorf("%v", data)
+	}
+
+	Pick([]Init{Zeros}, Ones)(data, 1, 1)
+	if data[0] != 0 {
+		t.Errorf("%v", data)
+	}
+}
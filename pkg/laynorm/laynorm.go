@@ -3,66 +3,92 @@ package laynorm
 import (
 	"math"
 	"ml/pkg/mat"
-	"ml/pkg/mlutil"
+	"ml/pkg/nn"
 )
 
-type LayNorm struct {
-	Gamma mat.Mat `json:"gamma"`
-	Beta  mat.Mat `json:"beta"`
+type LayNorm[T mat.Float] struct {
+	Gamma mat.Mat[T] `json:"gamma"`
+	Beta  mat.Mat[T] `json:"beta"`
 
-	x, xhat, mean, variance mat.Mat
+	x, xhat, mean, variance, std mat.Mat[T]
+	ans, dx                      mat.Mat[T]
+	dgamma, dbeta                mat.Mat[T]
 }
 
-func (ln *LayNorm) Forward(x mat.Mat) mat.Mat {
+var _ nn.Module[float64] = (*LayNorm[float64])(nil)
+
+func (ln *LayNorm[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
 	ln.x = x
 
 	const eps = 1e-6
 
-	ln.mean = x.Mean()
-	ln.variance = x.Var(ln.mean)
+	ln.mean = x.MeanTo(mat.Reuse(ln.mean, x.RowN(), 1))
+	ln.variance = x.VarTo(mat.Reuse(ln.variance, x.RowN(), 1), ln.mean)
 
-	ln.xhat = mat.New(x.RowN(), x.ColN())
-	for row := range x {
-		for col := range x[row] {
-			ln.xhat[row][col] =
-				(x[row][col] - ln.mean[row][0]) /
-					math.Sqrt(ln.variance[row][0]+eps)
-		}
+	ln.std = mat.Reuse(ln.std, x.RowN(), 1)
+	for row := range x.RowN() {
+		ln.std.Set(row, 0, T(math.Sqrt(float64(ln.variance.At(row, 0))+eps)))
 	}
 
-	xnorm := mat.New(x.RowN(), x.ColN())
-	for row := range ln.xhat {
-		xnorm[row] = mat.Mat{ln.xhat[row]}.
-			MulElwise(ln.Gamma).
-			Add(ln.Beta)[0]
-	}
+	ln.xhat = x.SubTo(mat.Reuse(ln.xhat, x.RowN(), x.ColN()), ln.mean).
+		DivInPlace(ln.std)
 
-	return xnorm
+	ln.ans = ln.xhat.MulElwiseTo(mat.Reuse(ln.ans, x.RowN(), x.ColN()), ln.Gamma).
+		AddInPlace(ln.Beta)
+
+	return ln.ans
 }
 
-func (ln *LayNorm) Backward(do mat.Mat, lrate float64) mat.Mat {
-	const eps = 1e-6
-	mean := do.Sub1(do.Mean())
-	dx := mat.New(do.RowN(), do.ColN())
-	for row := range dx.RowN() {
-		dx[row] = ln.Gamma.Scale(1 / math.Sqrt(ln.variance[row][0]+eps)).
-			MulElwise(mat.Mat{mean[row]})[0]
-	}
+// Backward градиент по x с учётом зависимости среднего и дисперсии строки от x:
+// dx = (g - mean(g) - xhat*mean(g*xhat)) / std, где g = do*Gamma
+func (ln *LayNorm[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	rown, coln := do.RowN(), do.ColN()
+
+	g := do.MulElwiseTo(mat.Get[T](rown, coln), ln.Gamma)
+	gxhat := g.MulElwiseTo(mat.Get[T](rown, coln), ln.xhat)
+	gmean := g.MeanTo(mat.Get[T](rown, 1))
+	gxhatmean := gxhat.MeanTo(mat.Get[T](rown, 1))
+
+	//столбцы gmean, gxhatmean и std транслируются в матрицу rown x coln
+	ln.dx = ln.xhat.MulElwiseTo(mat.Reuse(ln.dx, rown, coln), gxhatmean)
+	ln.dx = g.SubInPlace(gmean).SubInPlace(ln.dx).DivTo(ln.dx, ln.std)
 
-	ln.Gamma = mlutil.Upd(ln.Gamma, ln.xhat.MulElwise(do).ColSum(), lrate)
-	ln.Beta = mlutil.Upd(ln.Beta, do.ColSum(), lrate)
+	dparam := mat.Get[T](1, coln)
+	nn.Accumulate(&ln.dgamma, ln.xhat.MulElwiseTo(gxhat, do).ColSumTo(dparam))
+	nn.Accumulate(&ln.dbeta, do.ColSumTo(dparam))
 
-	return dx
+	mat.Put(g)
+	mat.Put(gxhat)
+	mat.Put(gmean)
+	mat.Put(gxhatmean)
+	mat.Put(dparam)
+
+	return ln.dx
 }
 
-func New(xcoln int) *LayNorm {
-	gamma := mat.New(1, xcoln)
-	for col := range gamma[0] {
-		gamma[0][col] = 1
+func New[T mat.Float](xcoln int) *LayNorm[T] {
+	gamma := mat.New[T](1, xcoln)
+	for col := range xcoln {
+		gamma.Set(0, col, 1)
 	}
 
-	return &LayNorm{
+	return &LayNorm[T]{
 		Gamma: gamma,
-		Beta:  mat.New(1, xcoln),
+		Beta:  mat.New[T](1, xcoln),
+	}
+}
+
+// Tensors возвращает матрицы нормализации с именами для сохранения в файл
+func (ln *LayNorm[T]) Tensors(prefix string) []mat.Tensor[T] {
+	return []mat.Tensor[T]{
+		{Name: prefix + "gamma", Mat: &ln.Gamma},
+		{Name: prefix + "beta", Mat: &ln.Beta},
+	}
+}
+
+func (ln *LayNorm[T]) Parameters() []*nn.Param[T] {
+	return []*nn.Param[T]{
+		{Name: "gamma", Value: &ln.Gamma, Grad: &ln.dgamma},
+		{Name: "beta", Value: &ln.Beta, Grad: &ln.dbeta},
 	}
 }
@@ -0,0 +1,72 @@
+package laynorm
+
+import (
+	"ml/pkg/gradcheck"
+	"ml/pkg/mat"
+	"testing"
+)
+
+func Test_Norm_GradCheck(t *testing.T) {
+	for _, kind := range []Kind{KindLayer, KindRMS} {
+		norm, err := NewNorm[float64](kind, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range norm.Parameters() {
+			p.Value.Copy(mat.New[float64](1, 5).Rand())
+		}
+		x, r := mat.New[float64](3, 5).Rand(), mat.New[float64](3, 5).Rand()
+
+		loss := func() float64 {
+			return gradcheck.Dot(norm.Forward(x), r)
+		}
+
+		backward := func() mat.Mat[float64] {
+			return norm.Backward(r)
+		}
+
+		results := gradcheck.Params(loss, backward, norm.Parameters(), &x)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%s:\n%s", kind, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_RMSNorm(t *testing.T) {
+	rn := NewRMS[float64](2)
+	ans := rn.Forward(mat.FromRows([][]float64{{3, 4}, {0, 0}}))
+
+	//rms первой строки sqrt(12.5)
+	want := mat.FromRows([][]float64{{.848528137423857, 1.131370849898476}, {0, 0}})
+	for row := range want.RowN() {
+		for col := range want.ColN() {
+			if d := ans.At(row, col) - want.At(row, col); d > 1e-6 || d < -1e-6 {
+				t.Errorf("%v != %v", ans.Slice(), want.Slice())
+			}
+		}
+	}
+}
+
+func Test_NewNorm(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		n    int
+		err  bool
+	}{
+		{"", 2, false},
+		{KindLayer, 2, false},
+		{KindRMS, 1, false},
+		{"batch", 0, true},
+	}
+
+	for i, test := range tests {
+		norm, err := NewNorm[float64](test.kind, 3)
+		if (err != nil) != test.err {
+			t.Errorf("%d: %v", i+1, err)
+			continue
+		}
+		if err == nil && len(norm.Parameters()) != test.n {
+			t.Errorf("%d: %d != %d", i+1, len(norm.Parameters()), test.n)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package laynorm
+
+import (
+	"fmt"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// Norm нормализация строк, LayNorm или RMSNorm
+type Norm[T mat.Float] interface {
+	nn.Module[T]
+	Tensors(prefix string) []mat.Tensor[T]
+}
+
+// Kind вид нормализации в настройках и JSON модели
+type Kind string
+
+const (
+	// KindLayer LayNorm, пустой Kind моделей, сохранённых до появления RMSNorm, означает его же
+	KindLayer Kind = "layer"
+	KindRMS   Kind = "rms"
+)
+
+var (
+	_ Norm[float64] = (*LayNorm[float64])(nil)
+	_ Norm[float64] = (*RMSNorm[float64])(nil)
+)
+
+// NewNorm создаёт нормализацию вида kind для строк длины xcoln
+func NewNorm[T mat.Float](kind Kind, xcoln int) (Norm[T], error) {
+	switch kind {
+	case KindLayer, "":
+		return New[T](xcoln), nil
+	case KindRMS:
+		return NewRMS[T](xcoln), nil
+	}
+	return nil, fmt.Errorf("неизвестная нормализация %q, доступны %q и %q", kind, KindLayer, KindRMS)
+}
@@ -0,0 +1,82 @@
+package laynorm
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// RMSNorm делит строку на её среднеквадратичное значение без вычитания среднего
+// и умножает на Gamma. Сдвига Beta нет.
+type RMSNorm[T mat.Float] struct {
+	Gamma mat.Mat[T] `json:"gamma"`
+
+	xhat, rms mat.Mat[T]
+	ans, dx   mat.Mat[T]
+	dgamma    mat.Mat[T]
+}
+
+var _ nn.Module[float64] = (*RMSNorm[float64])(nil)
+
+func (rn *RMSNorm[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	const eps = 1e-6
+
+	rn.rms = mat.Reuse(rn.rms, x.RowN(), 1)
+	for row := range x.RowN() {
+		var sum float64
+		for _, v := range x.Row(row) {
+			sum += float64(v) * float64(v)
+		}
+		rn.rms.Set(row, 0, T(math.Sqrt(sum/float64(x.ColN())+eps)))
+	}
+
+	rn.xhat = x.DivTo(mat.Reuse(rn.xhat, x.RowN(), x.ColN()), rn.rms)
+
+	rn.ans = rn.xhat.MulElwiseTo(mat.Reuse(rn.ans, x.RowN(), x.ColN()), rn.Gamma)
+
+	return rn.ans
+}
+
+// Backward dx = (g - xhat*mean(g*xhat)) / rms, где g = do*Gamma
+func (rn *RMSNorm[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	rown, coln := do.RowN(), do.ColN()
+
+	g := do.MulElwiseTo(mat.Get[T](rown, coln), rn.Gamma)
+	gxhat := g.MulElwiseTo(mat.Get[T](rown, coln), rn.xhat)
+	gxhatmean := gxhat.MeanTo(mat.Get[T](rown, 1))
+
+	rn.dx = rn.xhat.MulElwiseTo(mat.Reuse(rn.dx, rown, coln), gxhatmean)
+	rn.dx = g.SubInPlace(rn.dx).DivTo(rn.dx, rn.rms)
+
+	dgamma := mat.Get[T](1, coln)
+	nn.Accumulate(&rn.dgamma, rn.xhat.MulElwiseTo(gxhat, do).ColSumTo(dgamma))
+
+	mat.Put(g)
+	mat.Put(gxhat)
+	mat.Put(gxhatmean)
+	mat.Put(dgamma)
+
+	return rn.dx
+}
+
+func NewRMS[T mat.Float](xcoln int) *RMSNorm[T] {
+	gamma := mat.New[T](1, xcoln)
+	for col := range xcoln {
+		gamma.Set(0, col, 1)
+	}
+
+	return &RMSNorm[T]{Gamma: gamma}
+}
+
+// Tensors возвращает матрицы нормализации с именами для сохранения в файл
+func (rn *RMSNorm[T]) Tensors(prefix string) []mat.Tensor[T] {
+	return []mat.Tensor[T]{
+		{Name: prefix + "gamma", Mat: &rn.Gamma},
+	}
+}
+
+func (rn *RMSNorm[T]) Parameters() []*nn.Param[T] {
+	return []*nn.Param[T]{
+		{Name: "gamma", Value: &rn.Gamma, Grad: &rn.dgamma},
+	}
+}
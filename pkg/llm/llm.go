@@ -4,74 +4,413 @@ import (
 	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
-	"math"
+	"math/rand/v2"
+	"ml/pkg/activation"
 	"ml/pkg/attention"
 	"ml/pkg/bpe"
+	"ml/pkg/dropout"
+	"ml/pkg/embedding"
+	"ml/pkg/initializer"
 	"ml/pkg/laynorm"
 	"ml/pkg/mat"
 	"ml/pkg/mlp"
 	"ml/pkg/mlutil"
-	"os"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
+	"ml/pkg/schedule"
 	"strings"
 )
 
-type Layer struct {
-	MLP     *mlp.MLP             `json:"mlp"`
-	MHA     *attention.MultiHead `json:"mha"`
-	MHANorm *laynorm.LayNorm     `json:"mhanorm"`
-	MLPNorm *laynorm.LayNorm     `json:"mlpnorm"`
-	mhaInp  mat.Mat
-	mlpInp  mat.Mat
+// Layout расположение нормализаций в слое
+type Layout string
+
+const (
+	// LayoutPost нормализация суммы с остаточной связью: Norm(x + F(x)).
+	// Пустой Layout моделей, сохранённых раньше, означает его же.
+	LayoutPost Layout = "post"
+	// LayoutPre нормализация входа подслоя: x + F(Norm(x)).
+	// Устойчивее при нескольких слоях, обычно вместе с WithFinalNorm.
+	LayoutPre Layout = "pre"
+)
+
+func (l Layout) check() error {
+	switch l {
+	case LayoutPost, LayoutPre, "":
+		return nil
+	}
+	return fmt.Errorf("неизвестное расположение нормализаций %q, доступны %q и %q", l, LayoutPost, LayoutPre)
+}
+
+type Layer[T mat.Float] struct {
+	//блок прямого прохода: MLP или управляемый GLU, второй nil
+	MLP    *mlp.MLP[T]             `json:"mlp,omitempty"`
+	GLU    *mlp.GLU[T]             `json:"glu,omitempty"`
+	MHA    *attention.MultiHead[T] `json:"mha"`
+	Layout Layout                  `json:"layout,omitempty"`
+	//Norm вид MHANorm и MLPNorm, пустой у моделей с LayNorm, сохранённых раньше
+	Norm    laynorm.Kind    `json:"norm,omitempty"`
+	MHANorm laynorm.Norm[T] `json:"mhanorm"`
+	MLPNorm laynorm.Norm[T] `json:"mlpnorm"`
+	//dropout выходов MHA и MLP перед сложением с остаточной связью, nil - без него
+	MHADrop *dropout.Dropout[T] `json:"mhaDrop,omitempty"`
+	MLPDrop *dropout.Dropout[T] `json:"mlpDrop,omitempty"`
+	mhaInp  mat.Mat[T]
+	mlpInp  mat.Mat[T]
+	//буферы сумм с остаточными связями
+	mhaRes, mlpRes, dMLPRes, dx mat.Mat[T]
+}
+
+// feedForward блок прямого прохода
+type feedForward[T mat.Float] interface {
+	nn.Module[T]
+	Tensors(prefix string) []mat.Tensor[T]
+}
+
+// ffn возвращает блок прямого прохода слоя и его имя в ошибках и тензорах
+func (l *Layer[T]) ffn() (string, feedForward[T]) {
+	if l.GLU != nil {
+		return "glu", l.GLU
+	}
+	return "mlp", l.MLP
 }
 
-func (l *Layer) Forward(x mat.Mat) mat.Mat {
+// Forward при ошибке размеров паникует с указанием части слоя:
+// mha, mhanorm, mlp (glu) или mlpnorm
+func (l *Layer[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	if l.Layout == LayoutPre {
+		return l.preForward(x)
+	}
+
+	stage := "mha"
+	defer mat.Rethrow(&stage)
+
 	l.mhaInp = x
-	mhaAns := l.MHA.Forward(l.mhaInp)
-	l.mlpInp = l.MHANorm.Forward(mhaAns.Add(l.mhaInp))
-	mlpAns := l.MLP.Forward(l.mlpInp)
-	return l.MLPNorm.Forward(mlpAns.Add(l.mlpInp))
+	mhaAns := l.MHADrop.Forward(l.MHA.Forward(l.mhaInp))
+	l.mhaRes = mhaAns.AddTo(mat.Reuse(l.mhaRes, x.RowN(), x.ColN()), l.mhaInp)
+	stage = "mhanorm"
+	l.mlpInp = l.MHANorm.Forward(l.mhaRes)
+	stage, ffn := l.ffn()
+	mlpAns := l.MLPDrop.Forward(ffn.Forward(l.mlpInp))
+	l.mlpRes = mlpAns.AddTo(mat.Reuse(l.mlpRes, x.RowN(), x.ColN()), l.mlpInp)
+	stage = "mlpnorm"
+	return l.MLPNorm.Forward(l.mlpRes)
 }
 
-func (l *Layer) Backward(do mat.Mat, lrate float64) mat.Mat {
-	dMLPNorm := l.MLPNorm.Backward(do, lrate)
-	dMLP := l.MLP.BackwardMut(dMLPNorm, lrate)
-	dMHANorm := l.MHANorm.Backward(dMLP.Add(dMLPNorm), lrate)
-	dMHA := l.MHA.Backward(dMHANorm, lrate)
-	return dMHA.Add(dMHANorm)
+func (l *Layer[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	if l.Layout == LayoutPre {
+		return l.preBackward(do)
+	}
+
+	stage := "mlpnorm"
+	defer mat.Rethrow(&stage)
+
+	dMLPNorm := l.MLPNorm.Backward(do)
+	stage, ffn := l.ffn()
+	dMLP := ffn.Backward(l.MLPDrop.Backward(dMLPNorm))
+	l.dMLPRes = dMLP.AddTo(mat.Reuse(l.dMLPRes, do.RowN(), do.ColN()), dMLPNorm)
+	stage = "mhanorm"
+	dMHANorm := l.MHANorm.Backward(l.dMLPRes)
+	stage = "mha"
+	dMHA := l.MHA.Backward(l.MHADrop.Backward(dMHANorm))
+	l.dx = dMHA.AddTo(mat.Reuse(l.dx, do.RowN(), do.ColN()), dMHANorm)
+	return l.dx
 }
 
-func NewLayer(xrown, xcoln, wcoln, h int, alpha float64) *Layer {
-	return &Layer{
-		MHA:     attention.NewMultiHead(xrown, xcoln, wcoln, h),
-		MLP:     mlp.New(alpha, xrown, xcoln, xcoln*8, xcoln),
-		MHANorm: laynorm.New(xcoln),
-		MLPNorm: laynorm.New(xcoln),
+// preForward x + MHA(MHANorm(x)), затем h + MLP(MLPNorm(h))
+func (l *Layer[T]) preForward(x mat.Mat[T]) mat.Mat[T] {
+	stage := "mhanorm"
+	defer mat.Rethrow(&stage)
+
+	l.mhaInp = l.MHANorm.Forward(x)
+	stage = "mha"
+	mhaAns := l.MHADrop.Forward(l.MHA.Forward(l.mhaInp))
+	l.mhaRes = mhaAns.AddTo(mat.Reuse(l.mhaRes, x.RowN(), x.ColN()), x)
+	stage = "mlpnorm"
+	l.mlpInp = l.MLPNorm.Forward(l.mhaRes)
+	stage, ffn := l.ffn()
+	mlpAns := l.MLPDrop.Forward(ffn.Forward(l.mlpInp))
+	l.mlpRes = mlpAns.AddTo(mat.Reuse(l.mlpRes, x.RowN(), x.ColN()), l.mhaRes)
+	return l.mlpRes
+}
+
+// preBackward градиент остаточной связи проходит мимо нормализаций
+func (l *Layer[T]) preBackward(do mat.Mat[T]) mat.Mat[T] {
+	stage, ffn := l.ffn()
+	defer mat.Rethrow(&stage)
+
+	dMLP := ffn.Backward(l.MLPDrop.Backward(do))
+	stage = "mlpnorm"
+	dMLPNorm := l.MLPNorm.Backward(dMLP)
+	l.dMLPRes = dMLPNorm.AddTo(mat.Reuse(l.dMLPRes, do.RowN(), do.ColN()), do)
+	stage = "mha"
+	dMHA := l.MHA.Backward(l.MHADrop.Backward(l.dMLPRes))
+	stage = "mhanorm"
+	dMHANorm := l.MHANorm.Backward(dMHA)
+	l.dx = dMHANorm.AddTo(mat.Reuse(l.dx, do.RowN(), do.ColN()), l.dMLPRes)
+	return l.dx
+}
+
+// UnmarshalJSON создаёт нормализации вида Norm перед чтением их матриц
+func (l *Layer[T]) UnmarshalJSON(data []byte) error {
+	var kind struct {
+		Norm laynorm.Kind `json:"norm"`
+	}
+	err := json.Unmarshal(data, &kind)
+	if err != nil {
+		return err
 	}
+
+	if l.MHANorm, err = laynorm.NewNorm[T](kind.Norm, 0); err != nil {
+		return err
+	}
+	if l.MLPNorm, err = laynorm.NewNorm[T](kind.Norm, 0); err != nil {
+		return err
+	}
+
+	type layer Layer[T]
+	if err = json.Unmarshal(data, (*layer)(l)); err != nil {
+		return err
+	}
+	return l.Layout.check()
+}
+
+func (l *Layer[T]) Parameters() []*nn.Param[T] {
+	var params []*nn.Param[T]
+	params = append(params, nn.Prefix("mha.", l.MHA.Parameters())...)
+	params = append(params, nn.Prefix("mhanorm.", l.MHANorm.Parameters())...)
+	name, ffn := l.ffn()
+	params = append(params, nn.Prefix(name+".", ffn.Parameters())...)
+	return append(params, nn.Prefix("mlpnorm.", l.MLPNorm.Parameters())...)
+}
+
+func (l *Layer[T]) Tensors(prefix string) []mat.Tensor[T] {
+	var tensors []mat.Tensor[T]
+	tensors = append(tensors, l.MHA.Tensors(prefix+"mha.")...)
+	tensors = append(tensors, l.MHANorm.Tensors(prefix+"mhanorm.")...)
+	name, ffn := l.ffn()
+	tensors = append(tensors, ffn.Tensors(prefix+name+".")...)
+	return append(tensors, l.MLPNorm.Tensors(prefix+"mlpnorm.")...)
+}
+
+// NewLayer создаёт слой модели с LayNorm.
+// Необязательный init заполняет веса внимания и MLP.
+func NewLayer[T mat.Float](xrown, xcoln, wcoln, h int, alpha float64, init ...initializer.Init) *Layer[T] {
+	return newLayer[T](xrown, xcoln, wcoln, h, alpha, options{init: initializer.Pick(init, nil)})
 }
 
-type LLM struct {
+func newLayer[T mat.Float](xrown, xcoln, wcoln, h int, alpha float64, o options) *Layer[T] {
+	if err := o.layout.check(); err != nil {
+		panic(err)
+	}
+	mhaNorm, err := laynorm.NewNorm[T](o.norm, xcoln)
+	if err != nil {
+		panic(err)
+	}
+	mlpNorm, _ := laynorm.NewNorm[T](o.norm, xcoln)
+
+	l := &Layer[T]{
+		MHA:     attention.NewMultiHead[T](xrown, xcoln, wcoln, h, o.init),
+		Layout:  o.layout,
+		Norm:    o.norm,
+		MHANorm: mhaNorm,
+		MLPNorm: mlpNorm,
+	}
+
+	if o.attnDrop != 0 {
+		if err = l.MHA.SetDropout(o.attnDrop, o.seeds.Uint64()); err != nil {
+			panic(err)
+		}
+	}
+	if o.residDrop != 0 {
+		if l.MHADrop, err = dropout.New[T](o.residDrop, o.seeds.Uint64()); err != nil {
+			panic(err)
+		}
+		l.MLPDrop, _ = dropout.New[T](o.residDrop, o.seeds.Uint64())
+	}
+
+	act, hidden := o.ffn(xcoln)
+	init := initializer.Pick([]initializer.Init{o.init}, initializer.HeNormal)
+	if o.gated {
+		l.GLU = mlp.NewGLU[T](init, act, alpha, xrown, xcoln, hidden)
+		return l
+	}
+	l.MLP = mlp.NewInit[T](init, alpha, xrown, xcoln, hidden, xcoln)
+	l.MLP.Act = act
+	return l
+}
+
+type LLM[T mat.Float] struct {
 	//Отсортированный словарь токенов
-	Dict    *bpe.BPE `json:"dict"`
-	Embs    mat.Mat  `json:"embs"`
-	Layers  []*Layer `json:"layers"`
-	CtxSize int      `json:"ctxSize"`
-	Pos     mat.Mat  `json:"pos"`
+	Dict *bpe.BPE `json:"dict"`
+	//Embs векторы токенов, они же веса выходной проекции, если нет Proj
+	Embs    embedding.Embedding[T] `json:"embs"`
+	Layers  []*Layer[T]            `json:"layers"`
+	CtxSize int                    `json:"ctxSize"`
+	Pos     mat.Mat[T]             `json:"pos"`
+	//Final вид FinalNorm, пустой, если её нет
+	Final     laynorm.Kind    `json:"final,omitempty"`
+	FinalNorm laynorm.Norm[T] `json:"finalNorm,omitempty"`
+	//Untied выходная проекция Proj отдельно от Embs, тогда градиент Embs разреженный:
+	//nn.Step меняет только строки токенов окна
+	Untied bool       `json:"untied,omitempty"`
+	Proj   mat.Mat[T] `json:"proj"`
+
+	embs mat.Mat[T]
+	//буферы, переиспользуемые между шагами
+	inp, logits, dlay mat.Mat[T]
+	//градиенты, накопленные Backward
+	dembs, dpos, dproj mat.Mat[T]
+}
+
+var (
+	_ nn.Module[float64]    = (*Layer[float64])(nil)
+	_ nn.Trainable[float64] = (*LLM[float64])(nil)
+)
+
+// UnmarshalJSON создаёт FinalNorm вида Final перед чтением её матриц
+func (llm *LLM[T]) UnmarshalJSON(data []byte) error {
+	var kind struct {
+		Final laynorm.Kind `json:"final"`
+	}
+	err := json.Unmarshal(data, &kind)
+	if err != nil {
+		return err
+	}
+
+	if kind.Final != "" {
+		if llm.FinalNorm, err = laynorm.NewNorm[T](kind.Final, 0); err != nil {
+			return err
+		}
+	}
+
+	type model LLM[T]
+	return json.Unmarshal(data, (*model)(llm))
+}
+
+// Option необязательная настройка New
+type Option func(*options)
+
+type options struct {
+	init, embInit initializer.Init
+	norm          laynorm.Kind
+	layout        Layout
+	finalNorm     bool
+	//блок прямого прохода слоёв
+	ffnMult float64
+	act     activation.Name
+	gated   bool
+	untied  bool
+	//dropout вероятностей внимания и остаточный, seeds выдаёт начальные значения масок
+	attnDrop, residDrop float64
+	seeds               *rand.Rand
+}
+
+// ffn функция активации и ширина скрытого слоя блока прямого прохода,
+// по умолчанию LeakyReLU и 8*xcoln
+func (o options) ffn(xcoln int) (activation.Name, int) {
+	act, mult := o.act, o.ffnMult
+	if act == "" {
+		act = activation.LeakyReLU
+	}
+	if err := activation.Check(act); err != nil {
+		panic(err)
+	}
+	if mult == 0 {
+		mult = 8
+	}
+	return act, max(1, int(mult*float64(xcoln)))
+}
 
-	x, embs mat.Mat
+// WithInit задаёт заполнение весов внимания и MLP во всех слоях
+func WithInit(init initializer.Init) Option {
+	return func(o *options) {
+		o.init = init
+	}
+}
+
+// WithEmbInit задаёт заполнение Embs и Pos.
+// Например, для GPT: WithEmbInit(initializer.TruncNormal(.02)).
+func WithEmbInit(init initializer.Init) Option {
+	return func(o *options) {
+		o.embInit = init
+	}
+}
+
+// WithNorm задаёт вид нормализаций всех слоёв, по умолчанию laynorm.KindLayer
+func WithNorm(kind laynorm.Kind) Option {
+	return func(o *options) {
+		o.norm = kind
+	}
 }
 
-func New(layerN,
+// WithFFN задаёт ширину скрытого слоя блока прямого прохода mult*embSize
+// и его функцию активации. 0 и пустое имя оставляют 8 и LeakyReLU.
+func WithFFN(mult float64, act activation.Name) Option {
+	return func(o *options) {
+		o.ffnMult, o.act, o.gated = mult, act, false
+	}
+}
+
+// WithGLU то же, что WithFFN, но блок прямого прохода управляемый, mlp.GLU.
+// WithGLU(8./3, activation.SiLU) - SwiGLU с тем же числом весов, что у MLP ширины 4*embSize.
+func WithGLU(mult float64, act activation.Name) Option {
+	return func(o *options) {
+		o.ffnMult, o.act, o.gated = mult, act, true
+	}
+}
+
+// WithDropout включает dropout вероятностей внимания с вероятностью attn
+// и выходов MHA и MLP перед остаточной связью с вероятностью resid.
+// Маски всех слоёв выводятся из seed. Dropout действует только в режиме nn.Train.
+func WithDropout(attn, resid float64, seed uint64) Option {
+	return func(o *options) {
+		o.attnDrop, o.residDrop = attn, resid
+		o.seeds = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// WithUntied создаёт выходную проекцию отдельно от векторов токенов.
+// Шаг обучения меняет только векторы токенов окна, а не всю таблицу.
+func WithUntied() Option {
+	return func(o *options) {
+		o.untied = true
+	}
+}
+
+// WithLayout задаёт расположение нормализаций во всех слоях, по умолчанию LayoutPost
+func WithLayout(layout Layout) Option {
+	return func(o *options) {
+		o.layout = layout
+	}
+}
+
+// WithFinalNorm добавляет нормализацию вида WithNorm после последнего слоя,
+// перед умножением на Embs
+func WithFinalNorm() Option {
+	return func(o *options) {
+		o.finalNorm = true
+	}
+}
+
+func New[T mat.Float](layerN,
 	ctxSize,
 	embSize,
 	wcoln,
 	headN int,
 	alpha float64,
 	dictSrc string,
-) *LLM {
-	layers := make([]*Layer, 0, layerN)
+	opts ...Option,
+) *LLM[T] {
+	//init по умолчанию nil, тогда каждый слой выбирает своё заполнение
+	o := options{embInit: initializer.HeNormal}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	layers := make([]*Layer[T], 0, layerN)
 	for range layerN {
 		layers = append(layers,
-			NewLayer(ctxSize, embSize, wcoln, headN, alpha))
+			newLayer[T](ctxSize, embSize, wcoln, headN, alpha, o))
 	}
 
 	dict := bpe.New()
@@ -80,113 +419,253 @@ func New(layerN,
 		panic(err)
 	}
 
-	embs := mat.New(len(dict.Dict), embSize).Rand()
-	embs[dict.PadPos] = mat.New(1, embSize)[0]
+	embs := initializer.New[T](len(dict.Dict), embSize, o.embInit)
+	clear(embs.Row(dict.PadPos))
 
-	return &LLM{
+	llm := &LLM[T]{
 		Dict:    dict,
-		Embs:    embs,
+		Embs:    embedding.Embedding[T]{W: embs},
 		Layers:  layers,
 		CtxSize: ctxSize,
-		Pos:     mat.New(ctxSize, embSize).Rand(),
+		Pos:     initializer.New[T](ctxSize, embSize, o.embInit),
+	}
+	llm.Final, llm.FinalNorm = newFinalNorm[T](o, embSize)
+	if o.untied {
+		llm.Untied, llm.Proj = true, initializer.New[T](len(dict.Dict), embSize, o.embInit)
 	}
+
+	return llm
 }
 
-func (llm *LLM) Learn(text string, lrate float64, fileName string) {
-	marks := llm.Dict.Mark(llm.Dict.Tokenize(text))
-	oneHot := mat.New(len(marks), llm.Embs.RowN())
-	oneHot.OneHot(marks)
+// newFinalNorm нормализация после последнего слоя, если она включена WithFinalNorm
+func newFinalNorm[T mat.Float](o options, xcoln int) (laynorm.Kind, laynorm.Norm[T]) {
+	if !o.finalNorm {
+		return "", nil
+	}
 
-	pad := make([]float64, llm.Embs.RowN())
-	pad[llm.Dict.PadPos] = 1
+	kind := o.norm
+	if kind == "" {
+		kind = laynorm.KindLayer
+	}
+	norm, err := laynorm.NewNorm[T](kind, xcoln)
+	if err != nil {
+		panic(err)
+	}
+	return kind, norm
+}
 
-	for oneHot.RowN() <= llm.CtxSize {
-		oneHot = append(oneHot, pad)
+// Learn обучает модель на окнах текста, после каждого окна веса обновляет tr.
+// На время обучения включается режим nn.Train, Query работает без dropout.
+// Возвращает ошибку, если веса испортились и вернуть их нельзя, такую модель не стоит сохранять.
+func (llm *LLM[T]) Learn(text string, tr *optim.Trainer[T], fileName string) error {
+	defer nn.Train(nn.Train(true))
+
+	marks := llm.marks(text)
+	params := llm.Parameters()
+
+	for i := 0; i+1+llm.CtxSize <= len(marks); i++ {
+		logits := llm.Forward(marks[i : i+llm.CtxSize])
+		loss, grad := mat.SoftmaxCrossEntropyTo(logits, logits, marks[i+1:i+1+llm.CtxSize])
+		zap.S().Infof("%s CrossEntropy -> %.4f", fileName, loss)
+		llm.Backward(grad)
+		if err := tr.Step(params, loss); err != nil {
+			return err
+		}
 	}
 
-	for i := 0; i+1+llm.CtxSize <= len(oneHot); i++ {
-		answer := llm.Forward(oneHot[i : i+llm.CtxSize])
-		zap.S().Infof("%s CrossEntropy -> %.4f", fileName, answer.CrossEntropy(oneHot[i+1:i+1+llm.CtxSize]))
-		llm.Backward(answer.Sub(oneHot[i+1:i+1+llm.CtxSize]), lrate)
+	return nil
+}
+
+// Steps число шагов tr, которое сделает Learn на text, например для schedule.Cosine.Total
+func (llm *LLM[T]) Steps(text string) int {
+	return len(llm.marks(text)) - llm.CtxSize
+}
+
+// marks номера токенов text, дополненные до окна и следующего за ним токена
+func (llm *LLM[T]) marks(text string) []int {
+	marks := llm.Dict.Mark(llm.Dict.Tokenize(text))
+	for len(marks) <= llm.CtxSize {
+		marks = append(marks, llm.Dict.PadPos)
 	}
+	return marks
 }
 
-// Forward x матрица one-hot
-func (llm *LLM) Forward(x mat.Mat) mat.Mat {
-	llm.x = x
+// Forward возвращает логиты следующих токенов для окна из CtxSize номеров токенов.
+// Вероятности - Softmax логитов, для обучения используется mat.SoftmaxCrossEntropy.
+func (llm *LLM[T]) Forward(ids []int) mat.Mat[T] {
+	llm.inp = mat.Reuse(llm.inp, len(ids), llm.Embs.W.ColN()).
+		Copy(llm.Embs.Forward(ids)).
+		AddInPlace(llm.Pos)
 
-	embs := x.Mul(llm.Embs).Add(llm.Pos)
+	embs := llm.inp
 
-	for _, layer := range llm.Layers {
-		embs = layer.Forward(embs)
+	for i := range llm.Layers {
+		embs = llm.layerForward(i, embs)
+	}
+	if llm.FinalNorm != nil {
+		embs = llm.finalForward(embs)
 	}
 
 	llm.embs = embs
 
-	return embs.Mul(llm.Embs.T()).Softmax()
+	proj := llm.proj()
+	llm.logits = embs.MulTTo(mat.Reuse(llm.logits, len(ids), proj.RowN()), proj)
+
+	return llm.logits
+}
+
+// ForwardChecked то же, что Forward, но возвращает ошибку размеров вместо паники.
+// Ошибка содержит путь до места вычисления, например "layer 1: mha: head 0: MulT: ...".
+func (llm *LLM[T]) ForwardChecked(ids []int) (ans mat.Mat[T], err error) {
+	defer mat.Catch(&err)
+	return llm.Forward(ids), nil
+}
+
+func (llm *LLM[T]) layerForward(i int, x mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("layer", i)
+	return llm.Layers[i].Forward(x)
+}
+
+func (llm *LLM[T]) finalForward(x mat.Mat[T]) mat.Mat[T] {
+	stage := "finalnorm"
+	defer mat.Rethrow(&stage)
+	return llm.FinalNorm.Forward(x)
+}
+
+func (llm *LLM[T]) finalBackward(do mat.Mat[T]) mat.Mat[T] {
+	stage := "finalnorm"
+	defer mat.Rethrow(&stage)
+	return llm.FinalNorm.Backward(do)
+}
+
+func (llm *LLM[T]) layerBackward(i int, do mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("layer", i)
+	return llm.Layers[i].Backward(do)
+}
+
+// proj веса выходной проекции
+func (llm *LLM[T]) proj() mat.Mat[T] {
+	if llm.Untied {
+		return llm.Proj
+	}
+	return llm.Embs.W
 }
 
-func (llm *LLM) Backward(do mat.Mat, lrate float64) mat.Mat {
-	dlay := do.Mul(llm.Embs)
+// Backward прибавляет к градиентам Parameters градиент по логитам do последнего Forward.
+// Веса обновляет nn.Step.
+func (llm *LLM[T]) Backward(do mat.Mat[T]) {
+	proj := llm.proj()
+	llm.dlay = do.MulTo(mat.Reuse(llm.dlay, do.RowN(), proj.ColN()), proj)
+	dlay := llm.dlay
+	if llm.FinalNorm != nil {
+		dlay = llm.finalBackward(dlay)
+	}
 
 	for i := len(llm.Layers) - 1; i >= 0; i-- {
-		dlay = llm.Layers[i].Backward(dlay, lrate)
+		dlay = llm.layerBackward(i, dlay)
 	}
 
-	llm.Pos = mlutil.Upd(llm.Pos, dlay, lrate)
+	nn.Accumulate(&llm.dpos, dlay)
 
-	llm.Embs = mlutil.Upd(llm.Embs, llm.x.T().Mul(dlay).
-		Add(llm.embs.T().Mul(do).T()), lrate)
+	//выходная проекция даёт градиент всем своим строкам, вход - только строкам токенов окна
+	dproj := do.TMulTo(mat.Get[T](proj.RowN(), proj.ColN()), llm.embs)
+	if llm.Untied {
+		nn.Accumulate(&llm.dproj, dproj)
+		llm.Embs.Backward(dlay)
+	} else {
+		nn.Accumulate(&llm.dembs, dproj)
+		llm.Embs.BackwardTo(llm.dembs, dlay)
+	}
 
-	return nil
+	mat.Put(dproj)
 }
 
-func (llm *LLM) Save(to string) {
-	file, err := os.Create(to)
+// Save сохраняет модель в файл тензоров
+func (llm *LLM[T]) Save(to string) {
+	err := mlutil.SaveModel(to, llm, llm.Tensors())
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
+}
 
+// SaveJSON сохраняет модель в прежнем формате JSON
+func (llm *LLM[T]) SaveJSON(to string) {
+	//JSON не поддерживает -Inf из масок
 	for _, lay := range llm.Layers {
-		lay.MHA.Mask = nil
+		lay.MHA.Mask = mat.Mat[T]{}
 	}
 
-	err = json.
-		NewEncoder(file).
-		Encode(llm)
+	err := mlutil.SaveJSON(to, llm)
 	if err != nil {
 		panic(err)
 	}
 }
 
-func (llm *LLM) Query(query string) {
-	marks := llm.Dict.Mark(llm.Dict.Tokenize(query))
-	oneHot := mat.New(len(marks), llm.Embs.RowN())
-	oneHot.OneHot(marks)
+// Parameters обучаемые матрицы с теми же именами, что в Tensors, без масок внимания.
+// При Untied градиент embs разреженный, как у embedding.Embedding.
+func (llm *LLM[T]) Parameters() []*nn.Param[T] {
+	embs := &nn.Param[T]{Name: "embs", Value: &llm.Embs.W, Grad: &llm.dembs}
+	if llm.Untied {
+		embs = llm.Embs.Parameters()[0]
+		embs.Name = "embs"
+	}
+	params := []*nn.Param[T]{embs, {Name: "pos", Value: &llm.Pos, Grad: &llm.dpos}}
+	if llm.Untied {
+		params = append(params, &nn.Param[T]{Name: "proj", Value: &llm.Proj, Grad: &llm.dproj})
+	}
+	for i, l := range llm.Layers {
+		params = append(params, nn.Prefix(fmt.Sprintf("layers.%d.", i), l.Parameters())...)
+	}
+	if llm.FinalNorm != nil {
+		params = append(params, nn.Prefix("finalnorm.", llm.FinalNorm.Parameters())...)
+	}
+	return params
+}
 
-	pad := make([]float64, llm.Embs.RowN())
-	pad[llm.Dict.PadPos] = 1
+// SaveCheckpoint сохраняет модель вместе с состоянием opt и sched, чтобы продолжить обучение
+func (llm *LLM[T]) SaveCheckpoint(to string, opt optim.Optimizer[T], sched schedule.Schedule) error {
+	return optim.SaveCheckpoint(to, llm, llm.Tensors(), opt, sched)
+}
+
+// Tensors возвращает все матрицы модели с именами для сохранения в файл
+func (llm *LLM[T]) Tensors() []mat.Tensor[T] {
+	tensors := []mat.Tensor[T]{
+		{Name: "embs", Mat: &llm.Embs.W},
+		{Name: "pos", Mat: &llm.Pos},
+	}
+	if llm.Untied {
+		tensors = append(tensors, mat.Tensor[T]{Name: "proj", Mat: &llm.Proj})
+	}
+	for i, l := range llm.Layers {
+		tensors = append(tensors, l.Tensors(fmt.Sprintf("layers.%d.", i))...)
+	}
+	if llm.FinalNorm != nil {
+		tensors = append(tensors, llm.FinalNorm.Tensors("finalnorm.")...)
+	}
+	return tensors
+}
+
+func (llm *LLM[T]) Query(query string) {
+	const maxN = 128
+
+	marks := llm.Dict.Mark(llm.Dict.Tokenize(query))
 
 	var padn int
-	for oneHot.RowN() < llm.CtxSize {
-		oneHot = append(oneHot, pad)
+	for len(marks) < llm.CtxSize {
+		marks = append(marks, llm.Dict.PadPos)
 		padn++
 	}
 
-	for i := 0; i < 128; {
-		ans := llm.Forward(oneHot[i : i+llm.CtxSize])
-
-		_, index := mat.Mat{ans[len(ans)-padn-1]}.MaxIndex()
+	for i := 0; i < maxN; {
+		ans := llm.Forward(marks[i : i+llm.CtxSize])
 
-		newi := make([]float64, llm.Embs.RowN())
-		newi[index] = 1
+		_, index := ans.Rows(ans.RowN()-padn-1, ans.RowN()-padn).MaxIndex()
 
 		if padn != 0 {
-			oneHot[len(oneHot)-padn] = newi
+			marks[len(marks)-padn] = index
 			padn--
 		} else {
-			oneHot = append(oneHot, newi)
+			marks = append(marks, index)
 			i++
 		}
 
@@ -205,37 +684,72 @@ func (llm *LLM) Query(query string) {
 	}
 }
 
-func Load(src string, xrown int) (*LLM, error) {
-	file, err := os.Open(src)
+// Load загружает модель из файла тензоров или JSON.
+// Маски внимания строятся заново под размер контекста xrown.
+func Load[T mat.Float](src string, xrown int) (*LLM[T], error) {
+	var llm LLM[T]
+
+	err := mlutil.LoadModel(src, &llm, llm.Tensors)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	var llm LLM
+	mlp.WarnBias(src, mlp.CollapseBias(llm.ffns()...))
+	llm.prepare(xrown)
+	clear(llm.Embs.W.Row(llm.Dict.PadPos))
+
+	return &llm, nil
+}
+
+// LoadCheckpoint загружает файл SaveCheckpoint, состояние оптимизатора и расписания
+// записывается в opt и sched.
+// В отличие от Load, модель восстанавливается без изменений, чтобы продолжить обучение.
+func LoadCheckpoint[T mat.Float](src string, xrown int, opt optim.Optimizer[T], sched schedule.Schedule) (*LLM[T], error) {
+	var llm LLM[T]
 
-	err = json.
-		NewDecoder(file).
-		Decode(&llm)
+	err := optim.LoadCheckpoint(src, &llm, llm.Tensors, opt, sched)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, layer := range llm.Layers {
-		mask := mat.New(xrown, xrown)
-		for row := range mask {
-			for col := range mask[row] {
-				if row < col {
-					mask[row][col] = math.Inf(-1)
-				}
-			}
+	//состояние оптимизатора хранит матрицы размера старых смещений
+	if rown := mlp.CollapseBias(llm.ffns()...); rown > 1 {
+		return nil, fmt.Errorf("%s: смещения MLP из %d строк, загрузите модель через Load", src, rown)
+	}
+	llm.prepare(xrown)
+
+	return &llm, nil
+}
+
+// ffns блоки прямого прохода слоёв, смещения которых усредняет mlp.CollapseBias
+func (llm *LLM[T]) ffns() []mlp.Collapser {
+	ffns := make([]mlp.Collapser, 0, len(llm.Layers))
+	for _, l := range llm.Layers {
+		if l.GLU != nil {
+			ffns = append(ffns, l.GLU)
+			continue
 		}
-		layer.MHA.Mask = mask
+		ffns = append(ffns, l.MLP)
 	}
+	return ffns
+}
 
-	for i := range llm.Embs[llm.Dict.PadPos] {
-		llm.Embs[llm.Dict.PadPos][i] = 0
+// prepare строит маски внимания под размер контекста xrown после загрузки
+func (llm *LLM[T]) prepare(xrown int) {
+	for _, layer := range llm.Layers {
+		layer.MHA.Mask = attention.CausalMask[T](xrown)
 	}
+}
 
-	return &llm, nil
+// Convert загружает модель src и сохраняет её в dst с элементами типа T.
+// Например, Convert[float32] вдвое уменьшает модель, обученную во float64.
+func Convert[T mat.Float](src, dst string) error {
+	llm, err := Load[T](src, 0)
+	if err != nil {
+		return err
+	}
+
+	llm.Save(dst)
+
+	return nil
 }
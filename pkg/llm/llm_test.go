@@ -0,0 +1,427 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"ml/pkg/activation"
+	"ml/pkg/bpe"
+	"ml/pkg/dropout"
+	"ml/pkg/embedding"
+	"ml/pkg/gradcheck"
+	"ml/pkg/initializer"
+	"ml/pkg/laynorm"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"ml/pkg/optim"
+	"ml/pkg/schedule"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const ctx, emb, vocab = 4, 6, 5
+
+// configs устройства модели, которые проверяются в тестах сохранения и градиентов
+var configs = []options{
+	{},
+	{norm: laynorm.KindRMS},
+	{layout: LayoutPre, finalNorm: true},
+	{layout: LayoutPre, norm: laynorm.KindRMS, finalNorm: true},
+	{ffnMult: 2, act: activation.GELU},
+	{layout: LayoutPre, norm: laynorm.KindRMS, finalNorm: true, ffnMult: 8. / 3, act: activation.SiLU, gated: true},
+	{untied: true},
+}
+
+// newTest собирает маленькую модель без словаря из файла
+func newTest() (*LLM[float64], []int) {
+	return newTestWith(options{})
+}
+
+func newTestWith(o options) (*LLM[float64], []int) {
+	llm := &LLM[float64]{
+		Dict:    &bpe.BPE{},
+		Embs:    embedding.Embedding[float64]{W: mat.New[float64](vocab, emb).Rand()},
+		Pos:     mat.New[float64](ctx, emb).Rand(),
+		CtxSize: ctx,
+	}
+	for range 2 {
+		llm.Layers = append(llm.Layers, newLayer[float64](ctx, emb, 3, 2, .01, o))
+	}
+	llm.Final, llm.FinalNorm = newFinalNorm[float64](o, emb)
+	if o.untied {
+		llm.Untied, llm.Proj = true, mat.New[float64](vocab, emb).Rand()
+	}
+	clear(llm.Embs.W.Row(llm.Dict.PadPos))
+
+	return llm, []int{0, 1, 2, 3}
+}
+
+func Test_LLM_ForwardChecked(t *testing.T) {
+	llm, x := newTest()
+
+	if _, err := llm.ForwardChecked(x); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	//маска не совпадает с размером контекста
+	llm.Layers[1].MHA.Mask = mat.New[float64](ctx+1, ctx+1)
+
+	_, err := llm.ForwardChecked(x)
+
+	var shapeErr *mat.ShapeError
+	if !errors.As(err, &shapeErr) || !strings.HasPrefix(err.Error(), "layer 1: mha: head 0: Add:") {
+		t.Errorf("%v", err)
+	}
+}
+
+func Test_LLM_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	for i, o := range configs {
+		llm, x := newTestWith(o)
+		ans := llm.Forward(x).Clone()
+
+		bin, js := filepath.Join(dir, fmt.Sprint("llm", i)), filepath.Join(dir, fmt.Sprint("llm", i, ".json"))
+
+		llm.Save(bin)
+		llm.SaveJSON(js)
+
+		for _, src := range []string{bin, js} {
+			loaded, err := Load[float64](src, ctx)
+			if err != nil {
+				t.Fatalf("%s: %v", src, err)
+			}
+			if res := loaded.Forward(x); !res.Equal(ans) {
+				t.Errorf("%s: %v != %v", src, res.Slice(), ans.Slice())
+			}
+		}
+	}
+
+	llm, _ := newTest()
+	bin := filepath.Join(dir, "llm")
+	llm.Save(bin)
+
+	dst := filepath.Join(dir, "llm32")
+	if err := Convert[float32](bin, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load[float32](dst, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Embs.W.Equal(mat.Convert[float32](llm.Embs.W)) {
+		t.Errorf("%v", loaded.Embs.W.Slice())
+	}
+}
+
+func Test_LLM_Load_RowBias(t *testing.T) {
+	llm, x := newTest()
+	opt := optim.NewAdam[float64](.01)
+
+	//модель, сохранённая со смещением на каждую строку окна
+	lay := llm.Layers[0].MLP.Lays[1]
+	lay.Bias = mat.New[float64](ctx, emb).Rand()
+	want := lay.Bias.T().Mean().T()
+
+	dir := t.TempDir()
+	src, checkpoint := filepath.Join(dir, "llm"), filepath.Join(dir, "checkpoint")
+	llm.Save(src)
+	if err := llm.SaveCheckpoint(checkpoint, opt, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load[float64](src, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := loaded.Layers[0].MLP.Lays[1].Bias; !res.Equal(want) {
+		t.Errorf("%v != %v", res.Slice(), want.Slice())
+	}
+	if _, err = loaded.ForwardChecked(x); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = LoadCheckpoint(checkpoint, ctx, optim.NewAdam[float64](.01), nil); err == nil {
+		t.Error("контрольная точка со старыми смещениями загружена")
+	}
+}
+
+func Test_LLM_Untied(t *testing.T) {
+	llm, x := newTestWith(options{untied: true})
+	embs, proj := llm.Embs.W.Clone(), llm.Proj.Clone()
+
+	params := llm.Parameters()
+	llm.Backward(llm.Forward(x))
+	nn.Step(params, .1)
+
+	//меняются только векторы токенов окна и вся выходная проекция
+	if rows := *params[0].Rows; !slices.Equal(rows, x) {
+		t.Errorf("%v != %v", rows, x)
+	}
+	for row := range embs.RowN() {
+		if changed := !slices.Equal(embs.Row(row), llm.Embs.W.Row(row)); changed != slices.Contains(x, row) {
+			t.Errorf("%d: %v -> %v", row, embs.Row(row), llm.Embs.W.Row(row))
+		}
+	}
+	if llm.Proj.Equal(proj) {
+		t.Error("проекция не изменилась")
+	}
+}
+
+func Test_LLM_Checkpoint(t *testing.T) {
+	llm, ids := newTest()
+	opt, params := optim.NewAdam[float64](.01), llm.Parameters()
+
+	logits := llm.Forward(ids)
+	_, grad := mat.SoftmaxCrossEntropyTo(logits, logits, []int{1, 2, 3, 4})
+	llm.Backward(grad)
+	opt.Step(params)
+
+	src := filepath.Join(t.TempDir(), "checkpoint")
+	if err := llm.SaveCheckpoint(src, opt, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedOpt := optim.NewAdam[float64](1)
+	loaded, err := LoadCheckpoint(src, ctx, loadedOpt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, ans := loaded.Forward(ids), llm.Forward(ids); !res.Equal(ans) {
+		t.Errorf("%v != %v", res.Slice(), ans.Slice())
+	}
+	if len(loadedOpt.Names) != len(params) || !loadedOpt.Slots[0][0].Equal(opt.Slots[0][0]) || loadedOpt.Steps != 1 {
+		t.Errorf("%v %d", loadedOpt.Names, loadedOpt.Steps)
+	}
+}
+
+// withoutMasks убирает маски внимания, они не обучаются
+func withoutMasks(tensors []mat.Tensor[float64]) []mat.Tensor[float64] {
+	var ans []mat.Tensor[float64]
+	for _, tensor := range tensors {
+		if !strings.HasSuffix(tensor.Name, "mask") {
+			ans = append(ans, tensor)
+		}
+	}
+	return ans
+}
+
+func Test_Layer_GradCheck(t *testing.T) {
+	for i, o := range configs {
+		o.init = initializer.XavierNormal
+		l := newLayer[float64](ctx, emb, 3, 2, .01, o)
+		x, r := mat.New[float64](ctx, emb).Rand(), mat.New[float64](ctx, emb).Rand()
+
+		loss := func() float64 {
+			return gradcheck.Dot(l.Forward(x), r)
+		}
+
+		backward := func() mat.Mat[float64] {
+			return l.Backward(r)
+		}
+
+		results := gradcheck.Params(loss, backward, l.Parameters(), &x)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%d:\n%s", i+1, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_LLM_Parameters(t *testing.T) {
+	llm, ids := newTest()
+
+	logits := llm.Forward(ids)
+	_, grad := mat.SoftmaxCrossEntropyTo(logits, logits, []int{1, 2, 3, 4})
+	llm.Backward(grad)
+
+	params, tensors := llm.Parameters(), withoutMasks(llm.Tensors())
+	if len(params) != len(tensors) {
+		t.Fatalf("%d != %d", len(params), len(tensors))
+	}
+	for i, p := range params {
+		if p.Name != tensors[i].Name || p.Value != tensors[i].Mat {
+			t.Errorf("%d: %s != %s", i, p.Name, tensors[i].Name)
+		}
+		if p.Grad.RowN() != p.Value.RowN() || p.Grad.ColN() != p.Value.ColN() {
+			t.Errorf("%s: градиент %dx%d", p.Name, p.Grad.RowN(), p.Grad.ColN())
+		}
+	}
+}
+
+func Test_LLM_GradCheck(t *testing.T) {
+	targets := []int{1, 2, 3, 4}
+
+	for i, o := range configs {
+		llm, ids := newTestWith(o)
+
+		//SoftmaxCrossEntropyTo возвращает градиент суммы ошибок строк
+		loss := func() float64 {
+			return float64(len(ids)) * mat.SoftmaxCrossEntropy(llm.Forward(ids), targets)
+		}
+
+		backward := func() mat.Mat[float64] {
+			_, grad := mat.SoftmaxCrossEntropyTo(mat.New[float64](ctx, vocab), llm.Forward(ids), targets)
+			llm.Backward(grad)
+			return mat.Mat[float64]{}
+		}
+
+		results := gradcheck.Params(loss, backward, llm.Parameters(), nil)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%d:\n%s", i+1, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_Layer_FFN(t *testing.T) {
+	tests := []struct {
+		opt    Option
+		hidden int
+		act    activation.Name
+		gated  bool
+	}{
+		{func(*options) {}, 8 * emb, activation.LeakyReLU, false},
+		{WithFFN(4, activation.GELUTanh), 4 * emb, activation.GELUTanh, false},
+		{WithGLU(8./3, activation.SiLU), 16, activation.SiLU, true},
+	}
+
+	for i, test := range tests {
+		var o options
+		test.opt(&o)
+		l := newLayer[float64](ctx, emb, 3, 2, .01, o)
+
+		var hidden int
+		var act activation.Name
+		if l.GLU != nil {
+			hidden, act = l.GLU.Gate.Weight.ColN(), l.GLU.Act
+		} else {
+			hidden, act = l.MLP.Lays[0].Weight.ColN(), l.MLP.Act
+		}
+		if hidden != test.hidden || act != test.act || (l.GLU != nil) != test.gated {
+			t.Errorf("%d: %d %s %v", i+1, hidden, act, l.GLU != nil)
+		}
+	}
+}
+
+// resetDropout начинает маски слоя заново, чтобы ошибка при проверке градиента не менялась
+func resetDropout(l *Layer[float64]) {
+	for _, h := range l.MHA.Heads {
+		h.Drop.Reset()
+	}
+	l.MHADrop.Reset()
+	l.MLPDrop.Reset()
+}
+
+func Test_Layer_Dropout_GradCheck(t *testing.T) {
+	defer nn.Train(nn.Train(true))
+
+	for _, layout := range []Layout{LayoutPost, LayoutPre} {
+		var o options
+		WithDropout(.2, .2, 1)(&o)
+		o.init, o.layout = initializer.XavierNormal, layout
+		l := newLayer[float64](ctx, emb, 3, 2, .01, o)
+		x, r := mat.New[float64](ctx, emb).Rand(), mat.New[float64](ctx, emb).Rand()
+
+		loss := func() float64 {
+			resetDropout(l)
+			return gradcheck.Dot(l.Forward(x), r)
+		}
+
+		backward := func() mat.Mat[float64] {
+			return l.Backward(r)
+		}
+
+		results := gradcheck.Params(loss, backward, l.Parameters(), &x)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%s:\n%s", layout, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_LLM_Dropout(t *testing.T) {
+	var o options
+	WithDropout(.5, .5, 1)(&o)
+	llm, ids := newTestWith(o)
+
+	//та же модель без остаточного dropout, dropout внимания при выводе не действует
+	plain := *llm
+	plain.Layers = nil
+	for _, l := range llm.Layers {
+		c := *l
+		c.MHADrop, c.MLPDrop = nil, nil
+		plain.Layers = append(plain.Layers, &c)
+	}
+
+	ans := plain.Forward(ids).Clone()
+	if res := llm.Forward(ids); !res.Equal(ans) {
+		t.Errorf("при выводе: %v != %v", res.Slice(), ans.Slice())
+	}
+
+	prev := nn.Train(true)
+	if res := llm.Forward(ids); res.Equal(ans) {
+		t.Error("при обучении dropout не действует")
+	}
+	nn.Train(prev)
+
+	src := filepath.Join(t.TempDir(), "llm")
+	llm.Save(src)
+	loaded, err := Load[float64](src, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range loaded.Layers {
+		want := llm.Layers[i]
+		for _, d := range [][2]*dropout.Dropout[float64]{
+			{l.MHADrop, want.MHADrop}, {l.MLPDrop, want.MLPDrop}, {l.MHA.Heads[1].Drop, want.MHA.Heads[1].Drop},
+		} {
+			if d[0] == nil || d[0].Rate != d[1].Rate || d[0].Seed != d[1].Seed {
+				t.Errorf("%d: %+v != %+v", i, d[0], d[1])
+			}
+		}
+	}
+}
+
+func Test_LLM_Steps(t *testing.T) {
+	llm, _ := newTest()
+
+	for i, text := range []string{"", "а", "кот ест рыбу", "кот ест рыбу, а пёс спит"} {
+		sched := &schedule.Constant{Rate: .001}
+		tr := &optim.Trainer[float64]{Opt: optim.NewSGD[float64](0), Sched: sched}
+		if err := llm.Learn(text, tr, ""); err != nil {
+			t.Fatal(err)
+		}
+		if steps := llm.Steps(text); steps != sched.Step || steps < 1 {
+			t.Errorf("%d: %d != %d", i+1, steps, sched.Step)
+		}
+	}
+}
+
+func Test_LLM_PreNorm_Learn(t *testing.T) {
+	//шесть слоёв вместо двух
+	o := options{layout: LayoutPre, finalNorm: true}
+	llm, ids := newTestWith(o)
+	for range 4 {
+		llm.Layers = append(llm.Layers, newLayer[float64](ctx, emb, 3, 2, .01, o))
+	}
+	tr, params := optim.NewTrainer(optim.NewAdam[float64](.01)), llm.Parameters()
+	targets := []int{1, 2, 3, 4}
+
+	var first, loss float64
+	for i := range 100 {
+		logits := llm.Forward(ids)
+		loss, _ = mat.SoftmaxCrossEntropyTo(logits, logits, targets)
+		llm.Backward(logits)
+		if err := tr.Step(params, loss); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = loss
+		}
+	}
+
+	if !(loss < first/4) || tr.Skipped != 0 {
+		t.Errorf("%v -> %v, пропущено %d", first, loss, tr.Skipped)
+	}
+}
@@ -0,0 +1,101 @@
+package mat
+
+// elwiseOp поэлементная операция.
+// Как и kernel, выбирается значением, а не функцией, чтобы не выделять память.
+type elwiseOp int
+
+const (
+	addOp elwiseOp = iota
+	subOp
+	mulOp
+	divOp
+)
+
+// broadcast возвращает размер результата поэлементной операции над a и b
+func broadcast[T Float](op string, a, b Mat[T]) (rown, coln int) {
+	rown, okr := broadcastDim(a.rown, b.rown)
+	coln, okc := broadcastDim(a.coln, b.coln)
+	if !okr || !okc {
+		panic(&ShapeError{Op: op, A: a.shape(), B: b.shape()})
+	}
+	return rown, coln
+}
+
+func broadcastDim(a, b int) (int, bool) {
+	switch {
+	case a == b:
+		return a, true
+	case a == 1:
+		return b, true
+	case b == 1:
+		return a, true
+	}
+	return 0, false
+}
+
+// broadcastErr то же, что broadcast, но возвращает ошибку вместо паники
+func broadcastErr[T Float](op string, a, b Mat[T]) error {
+	_, okr := broadcastDim(a.rown, b.rown)
+	_, okc := broadcastDim(a.coln, b.coln)
+	if !okr || !okc {
+		return &ShapeError{Op: op, A: a.shape(), B: b.shape()}
+	}
+	return nil
+}
+
+// elwiseTo записывает результат op над m и b в dst.
+// dst может совпадать с операндом того же размера, что и результат.
+func (m Mat[T]) elwiseTo(op elwiseOp, name string, dst, b Mat[T]) Mat[T] {
+	rown, coln := broadcast(name, m, b)
+	checkDst(name, dst, rown, coln)
+
+	for row := range rown {
+		elwiseRow(op, dst.Row(row), m.Row(min(row, m.rown-1)), b.Row(min(row, b.rown-1)))
+	}
+
+	return dst
+}
+
+func elwiseRow[T Float](op elwiseOp, dst, a, b []T) {
+	if len(a) != len(b) {
+		//один из операндов - столбец, его значение повторяется по всей строке
+		for col := range dst {
+			dst[col] = apply(op, a[min(col, len(a)-1)], b[min(col, len(b)-1)])
+		}
+		return
+	}
+
+	dst, b = dst[:len(a)], b[:len(a)]
+
+	switch op {
+	case addOp:
+		for col, v := range a {
+			dst[col] = v + b[col]
+		}
+	case subOp:
+		for col, v := range a {
+			dst[col] = v - b[col]
+		}
+	case mulOp:
+		for col, v := range a {
+			dst[col] = v * b[col]
+		}
+	case divOp:
+		for col, v := range a {
+			dst[col] = v / b[col]
+		}
+	}
+}
+
+func apply[T Float](op elwiseOp, a, b T) T {
+	switch op {
+	case addOp:
+		return a + b
+	case subOp:
+		return a - b
+	case mulOp:
+		return a * b
+	default:
+		return a / b
+	}
+}
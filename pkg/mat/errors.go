@@ -0,0 +1,121 @@
+package mat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ShapeError несовместимые размеры матриц в операции Op.
+// A и B - размеры операндов в виде {строки, столбцы}.
+type ShapeError struct {
+	Op string
+	A  [2]int
+	B  [2]int
+}
+
+func (e *ShapeError) Error() string {
+	return fmt.Sprintf("%s: несовместимые размеры %dx%d и %dx%d",
+		e.Op, e.A[0], e.A[1], e.B[0], e.B[1])
+}
+
+func (m Mat[T]) shape() [2]int {
+	return [2]int{m.rown, m.coln}
+}
+
+// sameShape возвращает ошибку, если размеры a и b различаются
+func sameShape[T Float](op string, a, b Mat[T]) error {
+	if a.rown != b.rown || a.coln != b.coln {
+		return &ShapeError{Op: op, A: a.shape(), B: b.shape()}
+	}
+	return nil
+}
+
+func (m Mat[T]) MulChecked(b Mat[T]) (Mat[T], error) {
+	if m.ColN() != b.RowN() {
+		return Mat[T]{}, &ShapeError{Op: "Mul", A: m.shape(), B: b.shape()}
+	}
+	return m.Mul(b), nil
+}
+
+func (m Mat[T]) AddChecked(b Mat[T]) (Mat[T], error) {
+	if err := broadcastErr("Add", m, b); err != nil {
+		return Mat[T]{}, err
+	}
+	return m.Add(b), nil
+}
+
+func (m Mat[T]) SubChecked(b Mat[T]) (Mat[T], error) {
+	if err := broadcastErr("Sub", m, b); err != nil {
+		return Mat[T]{}, err
+	}
+	return m.Sub(b), nil
+}
+
+func (m Mat[T]) MulElwiseChecked(b Mat[T]) (Mat[T], error) {
+	if err := broadcastErr("MulElwise", m, b); err != nil {
+		return Mat[T]{}, err
+	}
+	return m.MulElwise(b), nil
+}
+
+func (m Mat[T]) DivChecked(b Mat[T]) (Mat[T], error) {
+	if err := broadcastErr("Div", m, b); err != nil {
+		return Mat[T]{}, err
+	}
+	return m.Div(b), nil
+}
+
+func (m Mat[T]) CrossEntropyChecked(truth Mat[T]) (float64, error) {
+	if err := sameShape("CrossEntropy", m, truth); err != nil {
+		return 0, err
+	}
+	return m.CrossEntropy(truth), nil
+}
+
+func (m Mat[T]) OneHotChecked(labels []int) error {
+	if m.RowN() != len(labels) {
+		return &ShapeError{Op: "OneHot", A: m.shape(), B: [2]int{len(labels), 1}}
+	}
+	m.OneHot(labels)
+	return nil
+}
+
+// Rethrow при панике с ошибкой добавляет к ней место вычисления *where
+// и продолжает панику. Вызывается через defer, поэтому *where
+// может меняться по ходу вычисления.
+func Rethrow(where *string) {
+	if r := recover(); r != nil {
+		panic(wrap(r, *where))
+	}
+}
+
+// RethrowAt то же, что Rethrow, для пронумерованных частей модели, например "layer 2"
+func RethrowAt(name string, i int) {
+	if r := recover(); r != nil {
+		panic(wrap(r, fmt.Sprintf("%s %d", name, i)))
+	}
+}
+
+func wrap(r any, where string) any {
+	if err, ok := r.(error); ok {
+		return fmt.Errorf("%s: %w", where, err)
+	}
+	return r
+}
+
+// Catch превращает панику с ошибкой размеров в значение *err.
+// Остальные паники продолжаются. Вызывается через defer.
+func Catch(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	e, ok := r.(error)
+	var shapeErr *ShapeError
+	if !ok || !errors.As(e, &shapeErr) {
+		panic(r)
+	}
+
+	*err = e
+}
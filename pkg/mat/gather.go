@@ -0,0 +1,40 @@
+package mat
+
+// Gather возвращает матрицу из строк m с номерами ids
+func (m Mat[T]) Gather(ids []int) Mat[T] {
+	return m.GatherTo(New[T](len(ids), m.ColN()), ids)
+}
+
+// GatherTo записывает в i-ю строку dst строку m с номером ids[i]
+func (m Mat[T]) GatherTo(dst Mat[T], ids []int) Mat[T] {
+	checkDst("Gather", dst, len(ids), m.ColN())
+
+	for i, id := range ids {
+		copy(dst.Row(i), m.Row(id))
+	}
+
+	return dst
+}
+
+// ScatterAdd прибавляет i-ю строку src к строке m с номером ids[i].
+// Повторяющиеся номера накапливаются.
+func (m Mat[T]) ScatterAdd(src Mat[T], ids []int) Mat[T] {
+	return m.ScatterAXPY(1, src, ids)
+}
+
+// ScatterAXPY то же, что AXPY, для строк m с номерами ids: m[ids[i]] += a*src[i].
+// Остальные строки m не читаются и не меняются.
+func (m Mat[T]) ScatterAXPY(a T, src Mat[T], ids []int) Mat[T] {
+	if src.RowN() != len(ids) || src.ColN() != m.ColN() {
+		panic(&ShapeError{Op: "ScatterAXPY", A: m.shape(), B: src.shape()})
+	}
+
+	for i, id := range ids {
+		mrow := m.Row(id)
+		for col, v := range src.Row(i) {
+			mrow[col] += a * v
+		}
+	}
+
+	return m
+}
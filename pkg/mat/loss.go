@@ -0,0 +1,106 @@
+package mat
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+func (m Mat[T]) LogSoftmax() Mat[T] {
+	return m.LogSoftmaxTo(New[T](m.RowN(), m.ColN()))
+}
+
+// LogSoftmaxTo записывает log(softmax) каждой строки m в dst, dst может совпадать с m.
+// В отличие от Log(Softmax) не теряет точность при малых вероятностях.
+func (m Mat[T]) LogSoftmaxTo(dst Mat[T]) Mat[T] {
+	checkDst("LogSoftmax", dst, m.RowN(), m.ColN())
+
+	for row := range m.rown {
+		mrow, dstrow := m.Row(row), dst.Row(row)
+		maxn, lse := logSumExp(mrow)
+
+		for col, v := range mrow {
+			dstrow[col] = T(float64(v-maxn) - lse)
+		}
+	}
+
+	return dst
+}
+
+// logSumExp возвращает максимум row и log(sum(exp(row - max)))
+func logSumExp[T Float](row []T) (T, float64) {
+	maxn := slices.Max(row)
+
+	var sum float64
+	for _, v := range row {
+		sum += math.Exp(float64(v - maxn))
+	}
+
+	return maxn, math.Log(sum)
+}
+
+// SoftmaxCrossEntropy возвращает среднюю по строкам ошибку
+// -log(softmax(logits)[target]), targets - номера верных классов строк
+func SoftmaxCrossEntropy[T Float](logits Mat[T], targets []int) float64 {
+	checkTargets(logits, targets)
+
+	var loss float64
+	for row := range logits.rown {
+		lrow := logits.Row(row)
+		maxn, lse := logSumExp(lrow)
+		loss += lse - float64(lrow[targets[row]]-maxn)
+	}
+
+	return loss / float64(logits.rown)
+}
+
+// SoftmaxCrossEntropyGrad то же, что SoftmaxCrossEntropyTo, но с новой матрицей градиента
+func SoftmaxCrossEntropyGrad[T Float](logits Mat[T], targets []int) (float64, Mat[T]) {
+	return SoftmaxCrossEntropyTo(New[T](logits.RowN(), logits.ColN()), logits, targets)
+}
+
+// SoftmaxCrossEntropyTo за один проход считает ошибку SoftmaxCrossEntropy
+// и записывает в dst её градиент по logits: softmax(logits) - onehot(targets).
+// Градиент не делится на число строк, как и прежний probs.Sub(truth).
+// dst может совпадать с logits.
+func SoftmaxCrossEntropyTo[T Float](dst, logits Mat[T], targets []int) (float64, Mat[T]) {
+	checkTargets(logits, targets)
+	checkDst("SoftmaxCrossEntropy", dst, logits.RowN(), logits.ColN())
+
+	var loss float64
+	for row := range logits.rown {
+		lrow, dstrow := logits.Row(row), dst.Row(row)
+		target := targets[row]
+		//запоминается до того, как dst перезапишет logits
+		maxn, logit := slices.Max(lrow), lrow[target]
+
+		//вероятности считаются так же, как в SoftmaxTo
+		var sum float64
+		for col, v := range lrow {
+			dstrow[col] = T(math.Exp(float64(v - maxn)))
+			sum += float64(dstrow[col])
+		}
+		loss += math.Log(sum) - float64(logit-maxn)
+
+		for col := range dstrow {
+			dstrow[col] = T(float64(dstrow[col]) / sum)
+		}
+		dstrow[target]--
+	}
+
+	return loss / float64(logits.rown), dst
+}
+
+// checkTargets паникует с ShapeError, если целей не столько, сколько строк,
+// или номер класса вне [0, ColN): в общем срезе он указал бы на логит другой строки
+func checkTargets[T Float](logits Mat[T], targets []int) {
+	if logits.RowN() != len(targets) {
+		panic(&ShapeError{Op: "SoftmaxCrossEntropy", A: logits.shape(), B: [2]int{len(targets), 1}})
+	}
+	for row, target := range targets {
+		if target < 0 || target >= logits.coln {
+			panic(&ShapeError{Op: fmt.Sprintf("SoftmaxCrossEntropy: класс %d строки %d", target, row),
+				A: logits.shape(), B: [2]int{len(targets), target}})
+		}
+	}
+}
@@ -1,307 +1,538 @@
 package mat
 
 import (
+	"encoding/json"
 	"math"
 	"math/rand/v2"
 	"slices"
 )
 
-type Mat [][]float64
+// Float допустимые типы элементов матрицы
+type Float interface {
+	float32 | float64
+}
 
-func (m Mat) RowN() int {
-	return len(m)
+// Mat матрица, элементы которой хранятся построчно в одном срезе.
+// Представления, полученные через Rows и Cols, разделяют память
+// с исходной матрицей, поэтому шаг между строками (stride)
+// может быть больше количества столбцов.
+type Mat[T Float] struct {
+	data   []T
+	rown   int
+	coln   int
+	stride int
 }
 
-func (m Mat) ColN() int {
-	if m.RowN() == 0 {
-		return 0
-	}
-	return len(m[0])
+func (m Mat[T]) RowN() int {
+	return m.rown
+}
+
+func (m Mat[T]) ColN() int {
+	return m.coln
+}
+
+func (m Mat[T]) At(row, col int) T {
+	return m.data[row*m.stride+col]
+}
+
+func (m Mat[T]) Set(row, col int, v T) {
+	m.data[row*m.stride+col] = v
+}
+
+// Row возвращает строку матрицы без копирования
+func (m Mat[T]) Row(row int) []T {
+	start := row * m.stride
+	return m.data[start : start+m.coln : start+m.coln]
 }
 
-func (m Mat) Mul(b Mat) Mat {
-	if m.ColN() != b.RowN() {
-		panic("Mul: m.ColN() != b.RowN()")
+// Rows возвращает представление строк [from, to) без копирования
+func (m Mat[T]) Rows(from, to int) Mat[T] {
+	if from < 0 || to > m.rown || from > to {
+		panic("Rows: индексы вне диапазона")
 	}
 
-	c := New(m.RowN(), b.ColN())
+	if from == to {
+		return Mat[T]{stride: m.stride, coln: m.coln}
+	}
 
-	for row := range c {
-		for col := range c[row] {
-			for mcol := range m[row] {
-				c[row][col] += m[row][mcol] * b[mcol][col]
-			}
-		}
+	return Mat[T]{
+		data:   m.data[from*m.stride : (to-1)*m.stride+m.coln],
+		rown:   to - from,
+		coln:   m.coln,
+		stride: m.stride,
+	}
+}
+
+// Cols возвращает представление столбцов [from, to) без копирования
+func (m Mat[T]) Cols(from, to int) Mat[T] {
+	if from < 0 || to > m.coln || from > to {
+		panic("Cols: индексы вне диапазона")
+	}
+
+	if m.rown == 0 {
+		return Mat[T]{coln: to - from, stride: m.stride}
 	}
 
-	return c
+	return Mat[T]{
+		data:   m.data[from : (m.rown-1)*m.stride+to],
+		rown:   m.rown,
+		coln:   to - from,
+		stride: m.stride,
+	}
 }
 
-func (m Mat) Add(b Mat) Mat {
-	if m.RowN() != b.RowN() || m.ColN() != b.ColN() {
-		panic("Add: m.RowN() != b.RowN() || m.ColN() != b.ColN()")
+// Clone возвращает непрерывную копию матрицы
+func (m Mat[T]) Clone() Mat[T] {
+	mat := New[T](m.rown, m.coln)
+	for row := range m.rown {
+		copy(mat.Row(row), m.Row(row))
 	}
+	return mat
+}
 
-	c := New(m.RowN(), m.ColN())
+// Equal сравнивает размеры и элементы матриц
+func (m Mat[T]) Equal(b Mat[T]) bool {
+	if m.rown != b.rown || m.coln != b.coln {
+		return false
+	}
 
-	for row := range c {
-		for col := range c[row] {
-			c[row][col] = m[row][col] + b[row][col]
+	for row := range m.rown {
+		if !slices.Equal(m.Row(row), b.Row(row)) {
+			return false
 		}
 	}
 
-	return c
+	return true
 }
 
-func (m Mat) Sub(b Mat) Mat {
-	if m.RowN() != b.RowN() || m.ColN() != b.ColN() {
-		panic("Sub: m.RowN() != b.RowN() || m.ColN() != b.ColN()")
+// Slice копирует матрицу в срез строк
+func (m Mat[T]) Slice() [][]T {
+	rows := make([][]T, 0, m.rown)
+	for row := range m.rown {
+		rows = append(rows, slices.Clone(m.Row(row)))
 	}
+	return rows
+}
 
-	c := New(m.RowN(), m.ColN())
+func (m Mat[T]) MarshalJSON() ([]byte, error) {
+	if m.data == nil && m.rown == 0 {
+		return []byte("null"), nil
+	}
+	return json.Marshal(m.Slice())
+}
 
-	for row := range c {
-		for col := range c[row] {
-			c[row][col] = m[row][col] - b[row][col]
-		}
+func (m *Mat[T]) UnmarshalJSON(data []byte) error {
+	var rows [][]T
+
+	err := json.Unmarshal(data, &rows)
+	if err != nil {
+		return err
 	}
 
-	return c
+	*m = FromRows(rows)
+
+	return nil
+}
+
+// Add, Sub, MulElwise и Div поэлементные операции с транслированием (broadcasting):
+// размеры операндов по строкам и столбцам либо совпадают, либо один из них равен 1,
+// например матрица 3x4 и строка 1x4 или столбец 3x1.
+
+func (m Mat[T]) Add(b Mat[T]) Mat[T] {
+	return m.AddTo(New[T](broadcast("Add", m, b)), b)
+}
+
+// AddTo записывает m + b в dst и возвращает dst
+func (m Mat[T]) AddTo(dst, b Mat[T]) Mat[T] {
+	return m.elwiseTo(addOp, "Add", dst, b)
+}
+
+// AddInPlace прибавляет b к m
+func (m Mat[T]) AddInPlace(b Mat[T]) Mat[T] {
+	return m.AddTo(m, b)
 }
 
-func (m Mat) Scale(n float64) Mat {
-	mat := New(m.RowN(), m.ColN())
+func (m Mat[T]) Sub(b Mat[T]) Mat[T] {
+	return m.SubTo(New[T](broadcast("Sub", m, b)), b)
+}
+
+// SubTo записывает m - b в dst и возвращает dst
+func (m Mat[T]) SubTo(dst, b Mat[T]) Mat[T] {
+	return m.elwiseTo(subOp, "Sub", dst, b)
+}
+
+// SubInPlace вычитает b из m
+func (m Mat[T]) SubInPlace(b Mat[T]) Mat[T] {
+	return m.SubTo(m, b)
+}
 
-	for row := range mat {
-		for col := range mat[row] {
-			mat[row][col] = m[row][col] * n
+func (m Mat[T]) Scale(n T) Mat[T] {
+	return m.ScaleTo(New[T](m.RowN(), m.ColN()), n)
+}
+
+func (m Mat[T]) ScaleTo(dst Mat[T], n T) Mat[T] {
+	checkDst("Scale", dst, m.RowN(), m.ColN())
+
+	for row := range m.rown {
+		dstrow := dst.Row(row)
+		for col, v := range m.Row(row) {
+			dstrow[col] = v * n
 		}
 	}
 
-	return mat
+	return dst
 }
 
-func (m Mat) MulElwise(b Mat) Mat {
-	if m.RowN() != b.RowN() || m.ColN() != b.ColN() {
-		panic("MulElwise: m.RowN() != b.RowN() || m.ColN() != b.ColN()")
-	}
+func (m Mat[T]) ScaleInPlace(n T) Mat[T] {
+	return m.ScaleTo(m, n)
+}
 
-	c := New(m.RowN(), m.ColN())
+// AXPY прибавляет к m матрицу x, умноженную на a: m += a*x
+func (m Mat[T]) AXPY(a T, x Mat[T]) Mat[T] {
+	if err := sameShape("AXPY", m, x); err != nil {
+		panic(err)
+	}
 
-	for row := range c {
-		for col := range c[row] {
-			c[row][col] = m[row][col] * b[row][col]
+	for row := range m.rown {
+		mrow := m.Row(row)
+		for col, v := range x.Row(row) {
+			mrow[col] += a * v
 		}
 	}
 
-	return c
+	return m
 }
 
-func (m Mat) T() Mat {
-	mat := New(m.ColN(), m.RowN())
+func (m Mat[T]) MulElwise(b Mat[T]) Mat[T] {
+	return m.MulElwiseTo(New[T](broadcast("MulElwise", m, b)), b)
+}
+
+func (m Mat[T]) MulElwiseTo(dst, b Mat[T]) Mat[T] {
+	return m.elwiseTo(mulOp, "MulElwise", dst, b)
+}
+
+func (m Mat[T]) MulElwiseInPlace(b Mat[T]) Mat[T] {
+	return m.MulElwiseTo(m, b)
+}
 
-	for row := range m {
-		for col := range m[row] {
-			mat[col][row] = m[row][col]
+// Div поэлементное деление m / b
+func (m Mat[T]) Div(b Mat[T]) Mat[T] {
+	return m.DivTo(New[T](broadcast("Div", m, b)), b)
+}
+
+func (m Mat[T]) DivTo(dst, b Mat[T]) Mat[T] {
+	return m.elwiseTo(divOp, "Div", dst, b)
+}
+
+func (m Mat[T]) DivInPlace(b Mat[T]) Mat[T] {
+	return m.DivTo(m, b)
+}
+
+func (m Mat[T]) T() Mat[T] {
+	return m.TTo(New[T](m.ColN(), m.RowN()))
+}
+
+// TTo записывает транспонированную m в dst, dst не должна пересекаться с m
+func (m Mat[T]) TTo(dst Mat[T]) Mat[T] {
+	checkDst("T", dst, m.ColN(), m.RowN())
+
+	for row := range m.rown {
+		for col, v := range m.Row(row) {
+			dst.data[col*dst.stride+row] = v
 		}
 	}
 
-	return mat
+	return dst
+}
+
+func (m Mat[T]) LeakyReLU(alpha T) Mat[T] {
+	return m.LeakyReLUTo(New[T](m.RowN(), m.ColN()), alpha)
 }
 
-func (m Mat) LeakyReLU(alpha float64) Mat {
-	mat := New(m.RowN(), m.ColN())
+func (m Mat[T]) LeakyReLUTo(dst Mat[T], alpha T) Mat[T] {
+	checkDst("LeakyReLU", dst, m.RowN(), m.ColN())
 
-	for row := range m {
-		for col := range m[row] {
-			mat[row][col] = max(m[row][col]*alpha, m[row][col])
+	for row := range m.rown {
+		dstrow := dst.Row(row)
+		for col, v := range m.Row(row) {
+			dstrow[col] = max(v*alpha, v)
 		}
 	}
 
-	return mat
+	return dst
 }
 
-func (m Mat) LeakyReLUDer(alpha float64) Mat {
-	mat := New(m.RowN(), m.ColN())
+func (m Mat[T]) LeakyReLUDer(alpha T) Mat[T] {
+	return m.LeakyReLUDerTo(New[T](m.RowN(), m.ColN()), alpha)
+}
+
+func (m Mat[T]) LeakyReLUDerTo(dst Mat[T], alpha T) Mat[T] {
+	checkDst("LeakyReLUDer", dst, m.RowN(), m.ColN())
 
-	for row := range m {
-		for col := range m[row] {
-			if m[row][col] >= 0 {
-				mat[row][col] = 1
+	for row := range m.rown {
+		dstrow := dst.Row(row)
+		for col, v := range m.Row(row) {
+			if v >= 0 {
+				dstrow[col] = 1
 				continue
 			}
-			mat[row][col] = alpha
+			dstrow[col] = alpha
 		}
 	}
 
-	return mat
+	return dst
+}
+
+func (m Mat[T]) Softmax() Mat[T] {
+	return m.SoftmaxTo(New[T](m.RowN(), m.ColN()))
 }
 
-func (m Mat) Softmax() Mat {
-	mat := New(m.RowN(), m.ColN())
+// SoftmaxTo записывает softmax каждой строки m в dst, dst может совпадать с m
+func (m Mat[T]) SoftmaxTo(dst Mat[T]) Mat[T] {
+	checkDst("Softmax", dst, m.RowN(), m.ColN())
 
-	for row := range m {
+	for row := range m.rown {
 		var sum float64
-		maxn := slices.Max(m[row])
+		mrow, dstrow := m.Row(row), dst.Row(row)
+		maxn := slices.Max(mrow)
 
-		for col := range m[row] {
-			mat[row][col] = math.Exp(m[row][col] - maxn)
-			sum += mat[row][col]
+		for col, v := range mrow {
+			dstrow[col] = T(math.Exp(float64(v - maxn)))
+			sum += float64(dstrow[col])
 		}
 
-		for col := range mat[row] {
-			mat[row][col] /= sum
+		for col := range dstrow {
+			dstrow[col] = T(float64(dstrow[col]) / sum)
 		}
 	}
 
-	return mat
+	return dst
 }
 
-func (m Mat) CrossEntropy(truth Mat) float64 {
-	if m.RowN() != truth.RowN() || m.ColN() != truth.ColN() {
-		panic("CrossEntropy: m.RowN() != truth.RowN() || m.ColN() != truth.ColN()")
+func (m Mat[T]) CrossEntropy(truth Mat[T]) float64 {
+	if err := sameShape("CrossEntropy", m, truth); err != nil {
+		panic(err)
 	}
 
 	const epsilon = 1e-12
 
 	var err float64
 
-	for row := range m {
-		for col := range m[row] {
-			err += truth[row][col] *
-				math.Log(max(epsilon, min(1-epsilon, m[row][col])))
+	for row := range m.rown {
+		truthrow := truth.Row(row)
+		for col, v := range m.Row(row) {
+			err += float64(truthrow[col]) *
+				math.Log(max(epsilon, min(1-epsilon, float64(v))))
 		}
 	}
 
 	return -(err / float64(m.RowN()))
 }
 
-func (m Mat) Rand() Mat {
+func (m Mat[T]) Rand() Mat[T] {
 	sqrt := math.Sqrt(2. / float64(m.RowN()))
 
-	for row := range m {
-		for col := range m[row] {
-			m[row][col] = rand.NormFloat64() * sqrt
+	for row := range m.rown {
+		mrow := m.Row(row)
+		for col := range mrow {
+			mrow[col] = T(rand.NormFloat64() * sqrt)
 		}
 	}
 
 	return m
 }
 
+// Zero обнуляет матрицу
+func (m Mat[T]) Zero() Mat[T] {
+	for row := range m.rown {
+		clear(m.Row(row))
+	}
+	return m
+}
+
+// Copy копирует src в m
+func (m Mat[T]) Copy(src Mat[T]) Mat[T] {
+	checkDst("Copy", m, src.RowN(), src.ColN())
+
+	for row := range m.rown {
+		copy(m.Row(row), src.Row(row))
+	}
+
+	return m
+}
+
 // Mean вычисляет среднее значение для каждой строки матрицы
-func (m Mat) Mean() Mat {
+func (m Mat[T]) Mean() Mat[T] {
+	return m.MeanTo(New[T](m.RowN(), 1))
+}
+
+func (m Mat[T]) MeanTo(dst Mat[T]) Mat[T] {
+	checkDst("Mean", dst, m.RowN(), 1)
+
 	coln := float64(m.ColN())
 
-	mean := New(m.RowN(), 1)
-	for row := range m {
-		for col := range m[row] {
-			mean[row][0] += m[row][col]
+	for row := range m.rown {
+		var sum float64
+		for _, v := range m.Row(row) {
+			sum += float64(v)
 		}
-		mean[row][0] /= coln
+		dst.Set(row, 0, T(sum/coln))
 	}
 
-	return mean
+	return dst
 }
 
 // Var вычисляет дисперсию для каждой строки
-func (m Mat) Var(mean Mat) Mat {
+func (m Mat[T]) Var(mean Mat[T]) Mat[T] {
+	return m.VarTo(New[T](m.RowN(), 1), mean)
+}
+
+func (m Mat[T]) VarTo(dst, mean Mat[T]) Mat[T] {
+	checkDst("Var", dst, m.RowN(), 1)
+
 	coln := float64(m.ColN())
 
-	variance := New(m.RowN(), 1)
-	for row := range m {
-		for col := range m[row] {
-			variance[row][0] += math.Pow(m[row][col]-mean[row][0], 2)
+	for row := range m.rown {
+		var sum float64
+		for _, v := range m.Row(row) {
+			sum += math.Pow(float64(v-mean.At(row, 0)), 2)
 		}
-		variance[row][0] /= coln
+		dst.Set(row, 0, T(sum/coln))
 	}
 
-	return variance
+	return dst
 }
 
-func (m Mat) ColSum() Mat {
-	mat := New(1, m.ColN())
-	for row := range m {
-		for col := range m[row] {
-			mat[0][col] += m[row][col]
+func (m Mat[T]) ColSum() Mat[T] {
+	return m.ColSumTo(New[T](1, m.ColN()))
+}
+
+func (m Mat[T]) ColSumTo(dst Mat[T]) Mat[T] {
+	checkDst("ColSum", dst, 1, m.ColN())
+
+	sum := dst.Zero().Row(0)
+	for row := range m.rown {
+		for col, v := range m.Row(row) {
+			sum[col] += v
 		}
 	}
-	return mat
+
+	return dst
+}
+
+func (m Mat[T]) RowSum() Mat[T] {
+	return m.RowSumTo(New[T](m.RowN(), 1))
 }
 
-func (m Mat) RowSum() Mat {
-	mat := New(m.RowN(), 1)
-	for row := range m {
-		for col := range m[row] {
-			mat[row][0] += m[row][col]
+func (m Mat[T]) RowSumTo(dst Mat[T]) Mat[T] {
+	checkDst("RowSum", dst, m.RowN(), 1)
+
+	for row := range m.rown {
+		var sum float64
+		for _, v := range m.Row(row) {
+			sum += float64(v)
 		}
+		dst.Set(row, 0, T(sum))
 	}
-	return mat
+
+	return dst
 }
 
-func (m Mat) Sub1(b Mat) Mat {
-	mat := New(m.RowN(), m.ColN())
+// SquareSum сумма квадратов элементов
+func (m Mat[T]) SquareSum() float64 {
+	var sum float64
+	for row := range m.rown {
+		for _, v := range m.Row(row) {
+			sum += float64(v) * float64(v)
+		}
+	}
+	return sum
+}
 
-	for row := range m {
-		for col := range m[row] {
-			mat[row][col] = m[row][col] - b[row][0]
+// Finite true, если в матрице нет NaN и ±Inf
+func (m Mat[T]) Finite() bool {
+	for row := range m.rown {
+		for _, v := range m.Row(row) {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				return false
+			}
 		}
 	}
+	return true
+}
 
-	return mat
+// Sub1 вычитает из каждой строки m соответствующий элемент столбца b.
+//
+// Deprecated: Sub транслирует столбец b сама.
+func (m Mat[T]) Sub1(b Mat[T]) Mat[T] {
+	return m.Sub(b)
 }
 
-func Concat(matrices ...Mat) Mat {
+// Deprecated: используйте SubTo.
+func (m Mat[T]) Sub1To(dst, b Mat[T]) Mat[T] {
+	return m.SubTo(dst, b)
+}
+
+func Concat[T Float](matrices ...Mat[T]) Mat[T] {
 	if len(matrices) == 0 {
 		panic("concat: empty matrices")
 	}
 
-	//предполагается, что количество строк в каждой матрице одинаково
-	mat := New(matrices[0].RowN(), 0)
+	var coln int
 	for _, m := range matrices {
-		for row := range m {
-			mat[row] = append(mat[row], m[row]...)
+		coln += m.ColN()
+	}
+
+	//предполагается, что количество строк в каждой матрице одинаково
+	return ConcatTo[T](New[T](matrices[0].RowN(), coln), matrices...)
+}
+
+// ConcatTo склеивает матрицы по столбцам в dst
+func ConcatTo[T Float](dst Mat[T], matrices ...Mat[T]) Mat[T] {
+	for row := range dst.rown {
+		dstrow := dst.Row(row)[:0]
+		for _, m := range matrices {
+			dstrow = append(dstrow, m.Row(row)...)
+		}
+		if len(dstrow) != dst.coln {
+			panic(&ShapeError{Op: "Concat", A: dst.shape(), B: [2]int{dst.rown, len(dstrow)}})
 		}
 	}
 
-	return mat
+	return dst
 }
 
-func Split(mat Mat, n int) []Mat {
+// Split делит матрицу по столбцам на n частей.
+// Части являются представлениями исходной матрицы.
+func Split[T Float](mat Mat[T], n int) []Mat[T] {
 	if mat.RowN() == 0 {
 		panic("невозможно разделить матрицу на n равных частей")
 	}
 
 	coln := int(math.Ceil(float64(mat.ColN()) / float64(n)))
 
-	mats := make([]Mat, 0, n)
-	for range n {
-		mats = append(mats, New(mat.RowN(), coln))
-	}
-
-	for row := range mat {
-		var i int
-		for chunk := range slices.Chunk(mat[row], coln) {
-			mats[i][row] = chunk
-			i++
-		}
+	mats := make([]Mat[T], 0, n)
+	for i := range n {
+		from := min(i*coln, mat.ColN())
+		mats = append(mats, mat.Cols(from, min(from+coln, mat.ColN())))
 	}
 
 	return mats
 }
 
-func (m Mat) MaxIndex() (int, int) {
+func (m Mat[T]) MaxIndex() (int, int) {
 	if m.RowN() == 0 || m.ColN() == 0 {
 		return 0, 0
 	}
 
 	var maxRow, maxCol int
-	maxVal := m[maxRow][maxCol]
+	maxVal := m.At(maxRow, maxCol)
 
-	for row := range m {
-		for col := range m[row] {
-			if maxVal < m[row][col] {
+	for row := range m.rown {
+		for col, v := range m.Row(row) {
+			if maxVal < v {
 				maxRow, maxCol = row, col
-				maxVal = m[row][col]
+				maxVal = v
 			}
 		}
 	}
@@ -309,26 +540,73 @@ func (m Mat) MaxIndex() (int, int) {
 	return maxRow, maxCol
 }
 
-func (m Mat) OneHot(labels []int) {
+// OneHot ставит 1 в столбец labels[row] каждой строки, метки вне [0, ColN) пропускаются
+func (m Mat[T]) OneHot(labels []int) {
 	if m.RowN() != len(labels) {
-		panic("m.RowN() != len(labels)")
+		panic(&ShapeError{Op: "OneHot", A: m.shape(), B: [2]int{len(labels), 1}})
 	}
 
-	for row := range m {
-		for col := range m[row] {
-			if col == labels[row] {
-				m[row][col] = 1
-				break
-			}
+	for row := range m.rown {
+		//отрицательная метка попала бы в предыдущую строку общего среза
+		if 0 <= labels[row] && labels[row] < m.coln {
+			m.Set(row, labels[row], 1)
 		}
 	}
 }
 
-func New(rown, coln int) Mat {
-	mat := make([][]float64, 0, rown)
+func New[T Float](rown, coln int) Mat[T] {
+	return Mat[T]{
+		data:   make([]T, rown*coln),
+		rown:   rown,
+		coln:   coln,
+		stride: coln,
+	}
+}
 
-	for range rown {
-		mat = append(mat, make([]float64, coln))
+// Reuse возвращает m, если её размер rown x coln, иначе новую матрицу.
+// Предназначена для буферов, которые слои переиспользуют между шагами.
+func Reuse[T Float](m Mat[T], rown, coln int) Mat[T] {
+	if m.rown == rown && m.coln == coln && m.stride == coln && m.data != nil {
+		return m
+	}
+	return New[T](rown, coln)
+}
+
+func checkDst[T Float](op string, dst Mat[T], rown, coln int) {
+	if dst.rown != rown || dst.coln != coln {
+		panic(&ShapeError{Op: op + ": dst", A: [2]int{rown, coln}, B: dst.shape()})
+	}
+}
+
+// FromRows копирует срез строк в новую матрицу
+func FromRows[T Float](rows [][]T) Mat[T] {
+	if len(rows) == 0 {
+		return Mat[T]{}
+	}
+
+	mat := New[T](len(rows), len(rows[0]))
+	for row := range rows {
+		if len(rows[row]) != mat.coln {
+			panic("FromRows: строки разной длины")
+		}
+		copy(mat.Row(row), rows[row])
+	}
+
+	return mat
+}
+
+// Convert копирует матрицу с приведением элементов к типу To
+func Convert[To, From Float](m Mat[From]) Mat[To] {
+	if m.data == nil && m.rown == 0 {
+		return Mat[To]{}
+	}
+
+	mat := New[To](m.rown, m.coln)
+	for row := range m.rown {
+		matrow := mat.Row(row)
+		for col, v := range m.Row(row) {
+			matrow[col] = To(v)
+		}
 	}
 
 	return mat
@@ -1,42 +1,48 @@
 package mat
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"math"
-	"reflect"
+	"math/rand/v2"
+	"strings"
 	"testing"
 )
 
 func Test_Mul(t *testing.T) {
 	tests := []struct {
-		a, b, c Mat
+		a, b, c [][]float64
 	}{
 		{
-			a: Mat{
+			a: [][]float64{
 				{-2, -1, -5},
 				{6, -5, -8},
 			},
-			b: Mat{
+			b: [][]float64{
 				{8, 9},
 				{1, 1},
 				{1, -4},
 			},
-			c: Mat{
+			c: [][]float64{
 				{-22, 1},
 				{35, 81},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{-6, -6},
 				{-7, 6},
 				{-8, -5},
 				{4, -5},
 			},
-			b: Mat{
+			b: [][]float64{
 				{1, 9, -7, 1},
 				{-5, 5, -1, 10},
 			},
-			c: Mat{
+			c: [][]float64{
 				{24, -84, 48, -66},
 				{-37, -33, 43, 53},
 				{17, -97, 61, -58},
@@ -44,68 +50,68 @@ func Test_Mul(t *testing.T) {
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{-3, -7, -2},
 				{4, 5, 10},
 			},
-			b: Mat{
+			b: [][]float64{
 				{6, -7, -5, 5},
 				{-8, 6, -7, -9},
 				{-9, 10, -2, -10},
 			},
-			c: Mat{
+			c: [][]float64{
 				{56, -41, 68, 68},
 				{-106, 102, -75, -125},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{-9, 5, -2},
 				{4, -2, 8},
 			},
-			b: Mat{
+			b: [][]float64{
 				{-8, -4, 10},
 				{-4, 1, 3},
 				{-1, -8, -9},
 			},
-			c: Mat{
+			c: [][]float64{
 				{54, 57, -57},
 				{-32, -82, -38},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{1, -10},
 				{0, 8},
 				{-2, -7},
 			},
-			b: Mat{
+			b: [][]float64{
 				{-8, 2, -6, 2},
 				{-4, -4, -2, -9},
 			},
-			c: Mat{
+			c: [][]float64{
 				{32, 42, 14, 92},
 				{-32, -32, -16, -72},
 				{44, 24, 26, 59},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{4, 0, 0},
 			},
-			b: Mat{
+			b: [][]float64{
 				{1, 4},
 				{3, 2},
 				{0, 0},
 			},
-			c: Mat{
+			c: [][]float64{
 				{4, 16},
 			},
 		},
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.a.Mul(test.b), test.c) {
+		if !FromRows(test.a).Mul(FromRows(test.b)).Equal(FromRows(test.c)) {
 			t.Errorf("%d: %v * %v != %v", i+1, test.a, test.b, test.c)
 		}
 	}
@@ -113,37 +119,37 @@ func Test_Mul(t *testing.T) {
 
 func Test_Add(t *testing.T) {
 	tests := []struct {
-		a, b, c Mat
+		a, b, c [][]float64
 	}{
 		{
-			a: Mat{
+			a: [][]float64{
 				{-17, -16, -15, 15},
 				{5, -17, -12, 11},
 				{-18, -7, 6, -17},
 			},
-			b: Mat{
+			b: [][]float64{
 				{-11, -5, -10, 10},
 				{-11, -13, -13, 5},
 				{-19, 16, -12, -14},
 			},
-			c: Mat{
+			c: [][]float64{
 				{-28, -21, -25, 25},
 				{-6, -30, -25, 16},
 				{-37, 9, -6, -31},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{-18, 11, 13},
 				{0, 14, -18},
 				{1, 14, -15},
 			},
-			b: Mat{
+			b: [][]float64{
 				{15, 17, 1},
 				{10, 15, 4},
 				{-10, 11, -16},
 			},
-			c: Mat{
+			c: [][]float64{
 				{-3, 28, 14},
 				{10, 29, -14},
 				{-9, 25, -31},
@@ -152,7 +158,7 @@ func Test_Add(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.a.Add(test.b), test.c) {
+		if !FromRows(test.a).Add(FromRows(test.b)).Equal(FromRows(test.c)) {
 			t.Errorf("%d: %v + %v != %v", i+1, test.a, test.b, test.c)
 		}
 	}
@@ -160,20 +166,20 @@ func Test_Add(t *testing.T) {
 
 func Test_Sub(t *testing.T) {
 	tests := []struct {
-		a, b, c Mat
+		a, b, c [][]float64
 	}{
 		{
-			a: Mat{
+			a: [][]float64{
 				{-13, 18, 11, -7},
 				{-7, -16, -5, -10},
 				{-19, 9, -5, 7},
 			},
-			b: Mat{
+			b: [][]float64{
 				{-5, 14, 20, 15},
 				{3, 5, -5, 12},
 				{6, 1, -13, 10},
 			},
-			c: Mat{
+			c: [][]float64{
 				{-8, 4, -9, -22},
 				{-10, -21, 0, -22},
 				{-25, 8, 8, -3},
@@ -182,7 +188,7 @@ func Test_Sub(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.a.Sub(test.b), test.c) {
+		if !FromRows(test.a).Sub(FromRows(test.b)).Equal(FromRows(test.c)) {
 			t.Errorf("%d: %v - %v != %v", i+1, test.a, test.b, test.c)
 		}
 	}
@@ -190,27 +196,27 @@ func Test_Sub(t *testing.T) {
 
 func Test_Scale(t *testing.T) {
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 		n      float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{4, 2},
 				{9, 0},
 			},
 			n: 5,
-			ans: Mat{
+			ans: [][]float64{
 				{20, 10},
 				{45, 0},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{10, 20},
 				{60, 80},
 			},
 			n: 1.0 / 2.0,
-			ans: Mat{
+			ans: [][]float64{
 				{5, 10},
 				{30, 40},
 			},
@@ -218,7 +224,7 @@ func Test_Scale(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.m.Scale(test.n), test.ans) {
+		if !FromRows(test.m).Scale(test.n).Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v * %f != %v", i+1, test.m, test.n, test.ans)
 		}
 	}
@@ -226,32 +232,32 @@ func Test_Scale(t *testing.T) {
 
 func Test_MulElwise(t *testing.T) {
 	tests := []struct {
-		a, b, c Mat
+		a, b, c [][]float64
 	}{
 		{
-			a: Mat{
+			a: [][]float64{
 				{5, 10, 30},
 				{10, 10, 20},
 			},
-			b: Mat{
+			b: [][]float64{
 				{1, 5, 10},
 				{10, 1, 5},
 			},
-			c: Mat{
+			c: [][]float64{
 				{5, 50, 300},
 				{100, 10, 100},
 			},
 		},
 		{
-			a: Mat{
+			a: [][]float64{
 				{5, 10, 30},
 				{10, 10, 20},
 			},
-			b: Mat{
+			b: [][]float64{
 				{0, 0, 0},
 				{10, 1, 5},
 			},
-			c: Mat{
+			c: [][]float64{
 				{0, 0, 0},
 				{100, 10, 100},
 			},
@@ -259,7 +265,7 @@ func Test_MulElwise(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.a.MulElwise(test.b), test.c) {
+		if !FromRows(test.a).MulElwise(FromRows(test.b)).Equal(FromRows(test.c)) {
 			t.Errorf("%d: %v @ %v != %v", i+1, test.a, test.b, test.c)
 		}
 	}
@@ -267,25 +273,25 @@ func Test_MulElwise(t *testing.T) {
 
 func Test_T(t *testing.T) {
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{2, 1},
 				{-3, 0},
 				{4, -1},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{2, -3, 4},
 				{1, 0, -1},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{2, -3, 4},
 				{1, 0, -1},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{2, 1},
 				{-3, 0},
 				{4, -1},
@@ -294,7 +300,7 @@ func Test_T(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if !reflect.DeepEqual(test.m.T(), test.ans) {
+		if !FromRows(test.m).T().Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %vT != %v", i+1, test.m, test.ans)
 		}
 	}
@@ -304,21 +310,21 @@ func Test_LeakyReLU(t *testing.T) {
 	const alpha float64 = .01
 
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{-.1, .1, 1, 0, -0},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{-.1 * alpha, .1, 1, 0, 0},
 			},
 		},
 	}
 
 	for i, test := range tests {
-		relu := test.m.LeakyReLU(alpha)
-		if !reflect.DeepEqual(relu, test.ans) {
+		relu := FromRows(test.m).LeakyReLU(alpha)
+		if !relu.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, relu, test.ans)
 		}
 	}
@@ -328,21 +334,21 @@ func Test_LeakyReLUDer(t *testing.T) {
 	const alpha float64 = .01
 
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{-.1, .1, 1, 0, -0},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{alpha, 1, 1, 1, 1},
 			},
 		},
 	}
 
 	for i, test := range tests {
-		der := test.m.LeakyReLUDer(alpha)
-		if !reflect.DeepEqual(der, test.ans) {
+		der := FromRows(test.m).LeakyReLUDer(alpha)
+		if !der.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, der, test.ans)
 		}
 	}
@@ -350,61 +356,61 @@ func Test_LeakyReLUDer(t *testing.T) {
 
 func Test_Softmax(t *testing.T) {
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{.15, .75, .8},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{21, 38, 40},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{3.15, 4.70, .30},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{17, 82, 1},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{3.15, 4.70, .30},
 				{.15, .75, .8},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{17, 82, 1},
 				{21, 38, 40},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{1_000, 1_050, 930},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{0, 100, 0},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{-1_000, -1_050, 930},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{0, 0, 100},
 			},
 		},
 	}
 
 	for i, test := range tests {
-		probs := test.m.Softmax()
-		for row := range probs {
-			for col := range probs[row] {
-				probs[row][col] = math.Round(probs[row][col] * 100)
+		probs := FromRows(test.m).Softmax()
+		for row := range probs.RowN() {
+			for col, prob := range probs.Row(row) {
+				probs.Set(row, col, math.Round(prob*100))
 			}
 		}
 
-		if !reflect.DeepEqual(probs, test.ans) {
+		if !probs.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, probs, test.ans)
 		}
 	}
@@ -412,40 +418,40 @@ func Test_Softmax(t *testing.T) {
 
 func Test_CrossEntropy(t *testing.T) {
 	tests := []struct {
-		m, truth Mat
+		m, truth [][]float64
 		ans      float64
 	}{
 		{
-			m:     Mat{{.75, .15, .10}},
-			truth: Mat{{1, 0, 0}},
+			m:     [][]float64{{.75, .15, .10}},
+			truth: [][]float64{{1, 0, 0}},
 			ans:   0.2876820724517809,
 		},
 		{
-			m:     Mat{{.75, .15, .10}},
-			truth: Mat{{0, 1, 0}},
+			m:     [][]float64{{.75, .15, .10}},
+			truth: [][]float64{{0, 1, 0}},
 			ans:   1.8971199848858813,
 		},
 		{
-			m:     Mat{{.75, .15, .10}},
-			truth: Mat{{0, 0, 1}},
+			m:     [][]float64{{.75, .15, .10}},
+			truth: [][]float64{{0, 0, 1}},
 			ans:   2.3025850929940455,
 		},
 		{
-			m:     Mat{{0, 0, 1}},
-			truth: Mat{{0, 0, 1}},
+			m:     [][]float64{{0, 0, 1}},
+			truth: [][]float64{{0, 0, 1}},
 			ans:   0,
 		},
 		{
-			m:     Mat{{.01, .01, .98}},
-			truth: Mat{{0, 1, 0}},
+			m:     [][]float64{{.01, .01, .98}},
+			truth: [][]float64{{0, 1, 0}},
 			ans:   4.605170185988092,
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{.65, .3, .05},
 				{.25, .25, .5},
 			},
-			truth: Mat{
+			truth: [][]float64{
 				{0, 1, 0},
 				{0, 0, 1},
 			},
@@ -454,7 +460,7 @@ func Test_CrossEntropy(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		ce := test.m.CrossEntropy(test.truth)
+		ce := FromRows(test.m).CrossEntropy(FromRows(test.truth))
 		if math.Abs(ce-test.ans) > 1e-6 {
 			t.Errorf("%d: %f != %f", i+1, ce, test.ans)
 		}
@@ -463,35 +469,35 @@ func Test_CrossEntropy(t *testing.T) {
 
 func Test_Mean(t *testing.T) {
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{3, 7, .5},
 				{9, 11, 2.52},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{3.5},
 				{7.506666666666667},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{0, 0, 0},
 				{9, 0, 0},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{0},
 				{3},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{-1, -1, -1},
 				{-1, -1, -1},
 				{-10, -10, -10},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{-1},
 				{-1},
 				{-10},
@@ -500,8 +506,8 @@ func Test_Mean(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		mean := test.m.Mean()
-		if !reflect.DeepEqual(mean, test.ans) {
+		mean := FromRows(test.m).Mean()
+		if !mean.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, mean, test.ans)
 		}
 	}
@@ -509,32 +515,32 @@ func Test_Mean(t *testing.T) {
 
 func Test_Var(t *testing.T) {
 	tests := []struct {
-		m, mean, ans Mat
+		m, mean, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{1., 2., 3., 4.},
 				{5., 6., 7., 8.},
 			},
-			mean: Mat{
+			mean: [][]float64{
 				{2.5},
 				{6.5},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{1.25},
 				{1.25},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{82, 101, 54.9},
 				{99, 12, 35.1},
 			},
-			mean: Mat{
+			mean: [][]float64{
 				{79.3},
 				{48.699999999999996},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{357.84666666666664},
 				{1353.9800000000002},
 			},
@@ -542,8 +548,8 @@ func Test_Var(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		variance := test.m.Var(test.mean)
-		if !reflect.DeepEqual(variance, test.ans) {
+		variance := FromRows(test.m).Var(FromRows(test.mean))
+		if !variance.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, variance, test.ans)
 		}
 	}
@@ -551,31 +557,31 @@ func Test_Var(t *testing.T) {
 
 func Test_RowSum(t *testing.T) {
 	tests := []struct {
-		m, ans Mat
+		m, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{10, 5, -1},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{14},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{10},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{10},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{3, .5, 2},
 				{-1, -1, .5},
 				{5, 5, -5},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{5.5},
 				{-1.5},
 				{5},
@@ -584,8 +590,8 @@ func Test_RowSum(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		sum := test.m.RowSum()
-		if !reflect.DeepEqual(sum, test.ans) {
+		sum := FromRows(test.m).RowSum()
+		if !sum.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, sum, test.ans)
 		}
 	}
@@ -593,52 +599,52 @@ func Test_RowSum(t *testing.T) {
 
 func Test_Sub1(t *testing.T) {
 	tests := []struct {
-		m, b, ans Mat
+		m, b, ans [][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{3, 2.5, .1},
 				{0, 2, -1},
 			},
-			b: Mat{
+			b: [][]float64{
 				{3},
 				{-1},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{0, -.5, -2.9},
 				{1, 3, 0},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{3},
 				{0},
 			},
-			b: Mat{
+			b: [][]float64{
 				{3},
 				{-1},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{0},
 				{1},
 			},
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{3, .5, 2},
 			},
-			b: Mat{
+			b: [][]float64{
 				{.5},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{2.5, 0, 1.5},
 			},
 		},
 	}
 
 	for i, test := range tests {
-		sub := test.m.Sub1(test.b)
-		if !reflect.DeepEqual(sub, test.ans) {
+		sub := FromRows(test.m).Sub1(FromRows(test.b))
+		if !sub.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, sub, test.ans)
 		}
 	}
@@ -646,11 +652,11 @@ func Test_Sub1(t *testing.T) {
 
 func Test_Concat(t *testing.T) {
 	tests := []struct {
-		ms  []Mat
-		ans Mat
+		ms  [][][]float64
+		ans [][]float64
 	}{
 		{
-			ms: []Mat{
+			ms: [][][]float64{
 				{
 					{3, .5},
 					{1, -.7},
@@ -668,7 +674,7 @@ func Test_Concat(t *testing.T) {
 					{.1},
 				},
 			},
-			ans: Mat{
+			ans: [][]float64{
 				{3, .5, -2, -3, -1, 0, -.5},
 				{1, -.7, 2, .1, -.1, 0, .1},
 			},
@@ -676,8 +682,13 @@ func Test_Concat(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		conc := Concat(test.ms...)
-		if !reflect.DeepEqual(conc, test.ans) {
+		ms := make([]Mat[float64], 0, len(test.ms))
+		for _, m := range test.ms {
+			ms = append(ms, FromRows(m))
+		}
+
+		conc := Concat(ms...)
+		if !conc.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, conc, test.ans)
 		}
 	}
@@ -685,17 +696,17 @@ func Test_Concat(t *testing.T) {
 
 func Test_Split(t *testing.T) {
 	tests := []struct {
-		m   Mat
+		m   [][]float64
 		n   int
-		ans []Mat
+		ans [][][]float64
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{3, .5, -2, -3, -1, 0, -.5, .2},
 				{1, -.7, 2, .1, -.1, 0, .1, .3},
 			},
 			n: 4,
-			ans: []Mat{
+			ans: [][][]float64{
 				{
 					{3, .5},
 					{1, -.7},
@@ -717,20 +728,26 @@ func Test_Split(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		split := Split(test.m, test.n)
-		if !reflect.DeepEqual(split, test.ans) {
-			t.Errorf("%d: %v != %v", i+1, split, test.ans)
+		split := Split(FromRows(test.m), test.n)
+		if len(split) != len(test.ans) {
+			t.Fatalf("%d: %d != %d", i+1, len(split), len(test.ans))
+		}
+
+		for j := range split {
+			if !split[j].Equal(FromRows(test.ans[j])) {
+				t.Errorf("%d: %v != %v", i+1, split[j].Slice(), test.ans[j])
+			}
 		}
 	}
 }
 
 func Test_MaxIndex(t *testing.T) {
 	tests := []struct {
-		m              Mat
+		m              [][]float64
 		maxRow, maxCol int
 	}{
 		{
-			m: Mat{
+			m: [][]float64{
 				{10, 30, -20},
 				{90, 60, 90},
 				{70, 30, 110},
@@ -739,14 +756,14 @@ func Test_MaxIndex(t *testing.T) {
 			maxCol: 2,
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{10, 30, -20},
 			},
 			maxRow: 0,
 			maxCol: 1,
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{10},
 				{400},
 				{600},
@@ -755,12 +772,12 @@ func Test_MaxIndex(t *testing.T) {
 			maxCol: 0,
 		},
 		{
-			m:      Mat{{}},
+			m:      [][]float64{{}},
 			maxRow: 0,
 			maxCol: 0,
 		},
 		{
-			m: Mat{
+			m: [][]float64{
 				{10},
 				{10},
 				{10},
@@ -771,7 +788,7 @@ func Test_MaxIndex(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		maxRow, maxCol := test.m.MaxIndex()
+		maxRow, maxCol := FromRows(test.m).MaxIndex()
 		if maxRow != test.maxRow || maxCol != test.maxCol {
 			t.Errorf("%d: %v != %v", i+1, maxRow, maxCol)
 		}
@@ -780,26 +797,753 @@ func Test_MaxIndex(t *testing.T) {
 
 func Test_OneHot(t *testing.T) {
 	tests := []struct {
-		m      Mat
+		m      Mat[float64]
 		labels []int
-		ans    Mat
+		ans    [][]float64
 	}{
 		{
-			m:      New(4, 10),
+			m:      New[float64](4, 10),
 			labels: []int{9, 8, 1, 3},
-			ans: Mat{
+			ans: [][]float64{
 				{0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
 				{0, 0, 0, 0, 0, 0, 0, 0, 1, 0},
 				{0, 1, 0, 0, 0, 0, 0, 0, 0, 0},
 				{0, 0, 0, 1, 0, 0, 0, 0, 0, 0},
 			},
 		},
+		{
+			m:      New[float64](3, 3),
+			labels: []int{-1, -1, 3},
+			ans: [][]float64{
+				{0, 0, 0},
+				{0, 0, 0},
+				{0, 0, 0},
+			},
+		},
 	}
 
 	for i, test := range tests {
 		test.m.OneHot(test.labels)
-		if !reflect.DeepEqual(test.m, test.ans) {
+		if !test.m.Equal(FromRows(test.ans)) {
 			t.Errorf("%d: %v != %v", i+1, test.m, test.ans)
 		}
 	}
 }
+
+func Test_Views(t *testing.T) {
+	m := FromRows([][]float64{
+		{1, 2, 3, 4},
+		{5, 6, 7, 8},
+		{9, 10, 11, 12},
+	})
+
+	rows := m.Rows(1, 3)
+	if !rows.Equal(FromRows([][]float64{{5, 6, 7, 8}, {9, 10, 11, 12}})) {
+		t.Errorf("rows: %v", rows.Slice())
+	}
+
+	cols := m.Cols(1, 3)
+	if !cols.Equal(FromRows([][]float64{{2, 3}, {6, 7}, {10, 11}})) {
+		t.Errorf("cols: %v", cols.Slice())
+	}
+
+	sub := rows.Cols(2, 4)
+	if !sub.Equal(FromRows([][]float64{{7, 8}, {11, 12}})) {
+		t.Errorf("rows.cols: %v", sub.Slice())
+	}
+
+	//представления разделяют память с исходной матрицей
+	sub.Set(0, 0, -7)
+	cols.Set(2, 0, -10)
+	if m.At(1, 2) != -7 || m.At(2, 1) != -10 {
+		t.Errorf("представление скопировало данные: %v", m.Slice())
+	}
+
+	mul := cols.Mul(FromRows([][]float64{{1}, {1}}))
+	if !mul.Equal(FromRows([][]float64{{5}, {-1}, {1}})) {
+		t.Errorf("mul по представлению: %v", mul.Slice())
+	}
+}
+
+func Test_JSON(t *testing.T) {
+	m := FromRows([][]float64{
+		{1, 2.5, 3},
+		{-4, 5, 6},
+	}).Cols(1, 3)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "[[2.5,3],[5,6]]" {
+		t.Errorf("%s", data)
+	}
+
+	var ans Mat[float64]
+	err = json.Unmarshal(data, &ans)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ans.Equal(m) {
+		t.Errorf("%v != %v", ans.Slice(), m.Slice())
+	}
+}
+
+// mulNaive эталонное умножение для сравнения
+func mulNaive[T Float](a, b Mat[T]) Mat[T] {
+	c := New[T](a.RowN(), b.ColN())
+
+	for row := range c.RowN() {
+		for col := range c.ColN() {
+			var sum T
+			for k := range a.ColN() {
+				sum += a.At(row, k) * b.At(k, col)
+			}
+			c.Set(row, col, sum)
+		}
+	}
+
+	return c
+}
+
+func randMat(rown, coln int) Mat[float64] {
+	m := New[float64](rown, coln)
+	for row := range rown {
+		for col := range coln {
+			m.Set(row, col, rand.Float64()*2-1)
+		}
+	}
+	return m
+}
+
+func equalApprox(a, b Mat[float64], eps float64) bool {
+	if a.RowN() != b.RowN() || a.ColN() != b.ColN() {
+		return false
+	}
+
+	for row := range a.RowN() {
+		for col := range a.ColN() {
+			if math.Abs(a.At(row, col)-b.At(row, col)) > eps {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func Test_Mul_Parallel(t *testing.T) {
+	defer SetWorkers(0)
+
+	tests := []struct {
+		arown, acoln, bcoln int
+	}{
+		{arown: 1, acoln: 1, bcoln: 1},
+		{arown: 3, acoln: 700, bcoln: 5},
+		{arown: 130, acoln: 300, bcoln: 600},
+		{arown: 257, acoln: 129, bcoln: 513},
+	}
+
+	for i, test := range tests {
+		a, b := randMat(test.arown, test.acoln), randMat(test.acoln, test.bcoln)
+		ans := mulNaive(a, b)
+
+		for _, n := range []int{1, 3, 8} {
+			SetWorkers(n)
+
+			if !equalApprox(a.Mul(b), ans, 1e-9) {
+				t.Errorf("%d: Mul, %d горутин", i+1, n)
+			}
+
+			if !equalApprox(a.MulT(b.T()), ans, 1e-9) {
+				t.Errorf("%d: MulT, %d горутин", i+1, n)
+			}
+
+			//представления с шагом строки больше количества столбцов
+			av := randMat(test.arown, test.acoln+3).Cols(2, test.acoln+2)
+			if !equalApprox(av.Mul(b), mulNaive(av, b), 1e-9) {
+				t.Errorf("%d: Mul по представлению, %d горутин", i+1, n)
+			}
+		}
+	}
+}
+
+func Test_MulT(t *testing.T) {
+	a := FromRows([][]float64{
+		{-2, -1, -5},
+		{6, -5, -8},
+	})
+	b := FromRows([][]float64{
+		{8, 1, 1},
+		{9, 1, -4},
+	})
+
+	ans := a.MulT(b)
+	if !ans.Equal(FromRows([][]float64{{-22, 1}, {35, 81}})) {
+		t.Errorf("%v", ans.Slice())
+	}
+
+	if !ans.Equal(a.Mul(b.T())) {
+		t.Errorf("%v != %v", ans.Slice(), a.Mul(b.T()).Slice())
+	}
+}
+
+// размеры проекции llm на словарь: ctxSize x embSize x размер словаря
+const benchRowN, benchK, benchColN = 256, 192, 2048
+
+func Benchmark_Mul(b *testing.B) {
+	x, w := randMat(benchRowN, benchK), randMat(benchK, benchColN)
+
+	b.Run("naive", func(b *testing.B) {
+		for range b.N {
+			mulNaive(x, w)
+		}
+	})
+
+	b.Run("serial", func(b *testing.B) {
+		SetWorkers(1)
+		defer SetWorkers(0)
+
+		for range b.N {
+			x.Mul(w)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for range b.N {
+			x.Mul(w)
+		}
+	})
+}
+
+func Benchmark_MulT(b *testing.B) {
+	x, w := randMat(benchRowN, benchK), randMat(benchColN, benchK)
+
+	b.Run("Mul(T())", func(b *testing.B) {
+		for range b.N {
+			x.Mul(w.T())
+		}
+	})
+
+	b.Run("MulT", func(b *testing.B) {
+		for range b.N {
+			x.MulT(w)
+		}
+	})
+}
+
+func Test_AXPY(t *testing.T) {
+	m := FromRows([][]float64{{1, 2}, {3, 4}})
+	m.AXPY(-.5, FromRows([][]float64{{2, 2}, {-2, 8}}))
+
+	if !m.Equal(FromRows([][]float64{{0, 1}, {4, 0}})) {
+		t.Errorf("%v", m.Slice())
+	}
+}
+
+func Test_SquareSum(t *testing.T) {
+	tests := []struct {
+		m    Mat[float64]
+		want float64
+	}{
+		{New[float64](0, 0), 0},
+		{FromRows([][]float64{{1, -2}, {3, 0}}), 14},
+		{FromRows([][]float64{{1, -2}, {3, 0}}).Cols(1, 2), 4},
+	}
+
+	for i, test := range tests {
+		if res := test.m.SquareSum(); res != test.want {
+			t.Errorf("%d: %v != %v", i+1, res, test.want)
+		}
+	}
+}
+
+func Test_Finite(t *testing.T) {
+	tests := []struct {
+		m    Mat[float64]
+		want bool
+	}{
+		{New[float64](2, 2), true},
+		{FromRows([][]float64{{1, math.NaN()}}), false},
+		{FromRows([][]float64{{math.Inf(-1), 1}}), false},
+		{FromRows([][]float64{{math.Inf(1), 1}}).Cols(1, 2), true},
+	}
+
+	for i, test := range tests {
+		if res := test.m.Finite(); res != test.want {
+			t.Errorf("%d: %v != %v", i+1, res, test.want)
+		}
+	}
+}
+
+func Test_TMul(t *testing.T) {
+	a, b := randMat(7, 5), randMat(7, 3)
+	if !a.TMul(b).Equal(a.T().Mul(b)) {
+		t.Errorf("%v != %v", a.TMul(b).Slice(), a.T().Mul(b).Slice())
+	}
+}
+
+func Test_To_Alias(t *testing.T) {
+	m := FromRows([][]float64{{1, 2, 3}, {-1, 0, 4}})
+	ans := m.Softmax()
+
+	if !m.SoftmaxTo(m).Equal(ans) {
+		t.Errorf("softmax на месте: %v != %v", m.Slice(), ans.Slice())
+	}
+
+	b := FromRows([][]float64{{1, 1, 1}, {2, 2, 2}})
+	ans = b.Add(b)
+	if !b.AddInPlace(b).Equal(ans) {
+		t.Errorf("сложение на месте: %v != %v", b.Slice(), ans.Slice())
+	}
+}
+
+func Test_Pool(t *testing.T) {
+	var p Pool[float64]
+
+	m := p.Get(3, 4)
+	m.Set(2, 3, 5)
+	p.Put(m)
+
+	//буфер переиспользуется и обнуляется
+	small := p.Get(2, 2)
+	if &small.data[:1][0] != &m.data[:1][0] {
+		t.Errorf("буфер не переиспользован")
+	}
+	if !small.Equal(New[float64](2, 2)) {
+		t.Errorf("буфер не обнулён: %v", small.Slice())
+	}
+
+	if allocs := testing.AllocsPerRun(10, func() {
+		p.Put(p.Get(2, 2))
+	}); allocs != 0 {
+		t.Errorf("%.1f выделений памяти", allocs)
+	}
+}
+
+func Test_Float32(t *testing.T) {
+	a, b := randMat(37, 29), randMat(29, 41)
+
+	ans := Convert[float32](a).Mul(Convert[float32](b))
+	if !equalApprox(Convert[float64](ans), a.Mul(b), 1e-4) {
+		t.Errorf("Mul float32 != Mul float64")
+	}
+
+	probs := Convert[float32](a).Softmax()
+	for row := range probs.RowN() {
+		var sum float32
+		for _, p := range probs.Row(row) {
+			sum += p
+		}
+		if math.Abs(float64(sum)-1) > 1e-5 {
+			t.Errorf("%d: сумма вероятностей %f", row, sum)
+		}
+	}
+
+	data, err := json.Marshal(Convert[float32](FromRows([][]float64{{.1, 2}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "[[0.1,2]]" {
+		t.Errorf("%s", data)
+	}
+}
+
+func Test_ShapeError(t *testing.T) {
+	a, b := New[float64](2, 3), New[float64](2, 2)
+
+	tests := []struct {
+		err   error
+		shape ShapeError
+	}{
+		{
+			err:   errOf(a.MulChecked(b)),
+			shape: ShapeError{Op: "Mul", A: [2]int{2, 3}, B: [2]int{2, 2}},
+		},
+		{
+			err:   errOf(a.AddChecked(b)),
+			shape: ShapeError{Op: "Add", A: [2]int{2, 3}, B: [2]int{2, 2}},
+		},
+		{
+			err:   errOf(a.SubChecked(b)),
+			shape: ShapeError{Op: "Sub", A: [2]int{2, 3}, B: [2]int{2, 2}},
+		},
+		{
+			err:   errOf(a.MulElwiseChecked(b)),
+			shape: ShapeError{Op: "MulElwise", A: [2]int{2, 3}, B: [2]int{2, 2}},
+		},
+		{
+			err:   errOf(a.CrossEntropyChecked(b)),
+			shape: ShapeError{Op: "CrossEntropy", A: [2]int{2, 3}, B: [2]int{2, 2}},
+		},
+		{
+			err:   a.OneHotChecked([]int{1}),
+			shape: ShapeError{Op: "OneHot", A: [2]int{2, 3}, B: [2]int{1, 1}},
+		},
+	}
+
+	for i, test := range tests {
+		var shapeErr *ShapeError
+		if !errors.As(test.err, &shapeErr) || *shapeErr != test.shape {
+			t.Errorf("%d: %v != %v", i, test.err, &test.shape)
+		}
+	}
+
+	if _, err := a.MulChecked(New[float64](3, 1)); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func errOf[V any](_ V, err error) error {
+	return err
+}
+
+func Test_Catch(t *testing.T) {
+	f := func() (err error) {
+		defer Catch(&err)
+
+		where := "first"
+		defer Rethrow(&where)
+
+		where = "second"
+		func() {
+			defer RethrowAt("part", 2)
+			New[float64](2, 3).Mul(New[float64](2, 2))
+		}()
+
+		return nil
+	}
+
+	err := f()
+	if err == nil || !strings.HasPrefix(err.Error(), "second: part 2: Mul:") {
+		t.Errorf("%v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != "other" {
+			t.Errorf("%v", r)
+		}
+	}()
+
+	func() (err error) {
+		defer Catch(&err)
+		panic("other")
+	}()
+}
+
+func Test_Broadcast(t *testing.T) {
+	shapes := [][2]int{{3, 4}, {1, 4}, {3, 1}, {1, 1}}
+
+	ops := []struct {
+		name string
+		f    func(a, b Mat[float64]) Mat[float64]
+		ref  func(a, b float64) float64
+	}{
+		{"Add", Mat[float64].Add, func(a, b float64) float64 { return a + b }},
+		{"Sub", Mat[float64].Sub, func(a, b float64) float64 { return a - b }},
+		{"MulElwise", Mat[float64].MulElwise, func(a, b float64) float64 { return a * b }},
+		{"Div", Mat[float64].Div, func(a, b float64) float64 { return a / b }},
+	}
+
+	//все сочетания размеров, включая внешние 1x4 и 3x1
+	for _, sa := range shapes {
+		for _, sb := range shapes {
+			a := randMat(sa[0], sa[1])
+			b := randMat(sb[0], sb[1]).AddInPlace(FromRows([][]float64{{2}}))
+
+			rown, coln := max(sa[0], sb[0]), max(sa[1], sb[1])
+
+			for _, op := range ops {
+				ans := op.f(a, b)
+				if ans.RowN() != rown || ans.ColN() != coln {
+					t.Fatalf("%s %v %v: %dx%d", op.name, sa, sb, ans.RowN(), ans.ColN())
+				}
+
+				for row := range rown {
+					for col := range coln {
+						want := op.ref(
+							a.At(min(row, sa[0]-1), min(col, sa[1]-1)),
+							b.At(min(row, sb[0]-1), min(col, sb[1]-1)))
+						if ans.At(row, col) != want {
+							t.Errorf("%s %v %v: (%d, %d) %v != %v",
+								op.name, sa, sb, row, col, ans.At(row, col), want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_Broadcast_Literal(t *testing.T) {
+	tests := []struct {
+		a, b, ans [][]float64
+		f         func(a, b Mat[float64]) Mat[float64]
+	}{
+		{
+			a:   [][]float64{{1, 2, 3}, {4, 5, 6}},
+			b:   [][]float64{{10, 20, 30}},
+			ans: [][]float64{{11, 22, 33}, {14, 25, 36}},
+			f:   Mat[float64].Add,
+		},
+		{
+			a:   [][]float64{{1, 2, 3}, {4, 5, 6}},
+			b:   [][]float64{{1}, {4}},
+			ans: [][]float64{{0, 1, 2}, {0, 1, 2}},
+			f:   Mat[float64].Sub,
+		},
+		{
+			a:   [][]float64{{1}, {2}},
+			b:   [][]float64{{1, 2, 3}},
+			ans: [][]float64{{1, 2, 3}, {2, 4, 6}},
+			f:   Mat[float64].MulElwise,
+		},
+		{
+			a:   [][]float64{{2, 4, 6}},
+			b:   [][]float64{{2}},
+			ans: [][]float64{{1, 2, 3}},
+			f:   Mat[float64].Div,
+		},
+	}
+
+	for i, test := range tests {
+		ans := test.f(FromRows(test.a), FromRows(test.b))
+		if !ans.Equal(FromRows(test.ans)) {
+			t.Errorf("%d: %v != %v", i+1, ans.Slice(), test.ans)
+		}
+	}
+}
+
+func Test_Broadcast_Error(t *testing.T) {
+	tests := [][2][2]int{
+		{{3, 4}, {2, 4}},
+		{{3, 4}, {3, 2}},
+		{{1, 4}, {3, 2}},
+		{{3, 1}, {2, 4}},
+	}
+
+	for i, test := range tests {
+		a, b := New[float64](test[0][0], test[0][1]), New[float64](test[1][0], test[1][1])
+
+		_, err := a.AddChecked(b)
+		var shapeErr *ShapeError
+		if !errors.As(err, &shapeErr) || shapeErr.A != test[0] || shapeErr.B != test[1] {
+			t.Errorf("%d: %v", i+1, err)
+		}
+	}
+
+	//результат транслирования не помещается в m
+	defer func() {
+		if _, ok := recover().(*ShapeError); !ok {
+			t.Errorf("нет паники ShapeError")
+		}
+	}()
+	New[float64](1, 4).AddInPlace(New[float64](3, 4))
+}
+
+func Test_Tensors(t *testing.T) {
+	a := FromRows([][]float64{{1, -2.5, 3}, {math.Inf(-1), 0, 1e-300}})
+	b := FromRows([][]float64{{.1}, {.2}})
+	var empty Mat[float64]
+
+	//пустая матрица начинается там же, где b
+	var buf bytes.Buffer
+	err := WriteTensors(&buf, map[string]string{"k": "v"}, []Tensor[float64]{
+		{Name: "a", Mat: &a},
+		{Name: "empty", Mat: &empty},
+		{Name: "b", Mat: &b},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len()%8 != 0 || !IsTensorFile(bufio.NewReader(bytes.NewReader(buf.Bytes()))) {
+		t.Fatalf("неверный заголовок")
+	}
+
+	meta, mats, err := ReadTensors[float64](bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["k"] != "v" || !mats["a"].Equal(a) || !mats["b"].Equal(b) ||
+		mats["empty"].RowN() != 0 || len(mats) != 3 {
+		t.Errorf("%v %v", meta, mats)
+	}
+
+	//чтение с приведением float64 -> float32
+	_, mats32, err := ReadTensors[float32](bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mats32["b"].Equal(Convert[float32](b)) {
+		t.Errorf("%v", mats32["b"].Slice())
+	}
+}
+
+// tensorFile файл тензоров с заголовком header и body нулевыми байтами данных
+func tensorFile(header string, body int) []byte {
+	data := binary.LittleEndian.AppendUint64(nil, uint64(len(header)))
+	data = append(data, header...)
+	return append(data, make([]byte, body)...)
+}
+
+func Test_ReadTensors_Corrupt(t *testing.T) {
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{binary.LittleEndian.AppendUint64(nil, 1<<62), "длина заголовка"},
+		{tensorFile("{}", 0), ""},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[1,1],"data_offsets":[8,16]}}`, 8), "data_offsets"},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[1,3],"data_offsets":[0,16]}}`, 24), "data_offsets"},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[-1,2],"data_offsets":[0,16]}}`, 16), "shape"},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[4611686018427387904,4],"data_offsets":[0,0]}}`, 16), "shape"},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[1,2],"data_offsets":[-8,8]}}`, 16), "data_offsets"},
+		{tensorFile(`{"a":{"dtype":"F64","shape":[1,2],"data_offsets":[0,16]}}`, 16), ""},
+	}
+
+	for i, test := range tests {
+		_, _, err := ReadTensors[float64](bytes.NewReader(test.data))
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%d: %v, ожидается %q", i+1, err, test.err)
+		}
+	}
+}
+
+func Test_IsTensorFile(t *testing.T) {
+	tests := []struct {
+		data string
+		ans  bool
+	}{
+		{data: `{"embs":[[1,2]]}`, ans: false},
+		{data: "  \n{}", ans: false},
+		{data: "\x10\x00\x00\x00\x00\x00\x00\x00{}              ", ans: true},
+		{data: "", ans: false},
+	}
+
+	for i, test := range tests {
+		if ans := IsTensorFile(bufio.NewReader(strings.NewReader(test.data))); ans != test.ans {
+			t.Errorf("%d: %v != %v", i+1, ans, test.ans)
+		}
+	}
+}
+
+func Test_LogSoftmax(t *testing.T) {
+	m := randMat(3, 5)
+
+	logs := m.LogSoftmax()
+	probs := m.Softmax()
+	for row := range m.RowN() {
+		for col := range m.ColN() {
+			if math.Abs(logs.At(row, col)-math.Log(probs.At(row, col))) > 1e-12 {
+				t.Errorf("(%d, %d) %v != %v", row, col, logs.At(row, col), math.Log(probs.At(row, col)))
+			}
+		}
+	}
+
+	//log(softmax) через Softmax даёт -Inf, LogSoftmax - точное значение
+	big := FromRows([][]float64{{1000, 0, -1000}}).LogSoftmax()
+	if !big.Equal(FromRows([][]float64{{0, -1000, -2000}})) {
+		t.Errorf("%v", big.Slice())
+	}
+}
+
+func Test_SoftmaxCrossEntropy(t *testing.T) {
+	logits := randMat(4, 6).ScaleInPlace(3)
+	targets := []int{0, 5, 2, 2}
+
+	truth := New[float64](4, 6)
+	truth.OneHot(targets)
+
+	loss := SoftmaxCrossEntropy(logits, targets)
+	if want := logits.Softmax().CrossEntropy(truth); math.Abs(loss-want) > 1e-9 {
+		t.Errorf("%v != %v", loss, want)
+	}
+
+	loss2, grad := SoftmaxCrossEntropyGrad(logits, targets)
+	if loss2 != loss || !grad.Equal(logits.Softmax().Sub(truth)) {
+		t.Errorf("%v %v", loss2, grad.Slice())
+	}
+
+	//градиент суммы ошибок строк, то есть RowN() * loss
+	const h = 1e-6
+	for row := range logits.RowN() {
+		for col := range logits.ColN() {
+			v := logits.At(row, col)
+			logits.Set(row, col, v+h)
+			up := SoftmaxCrossEntropy(logits, targets)
+			logits.Set(row, col, v-h)
+			down := SoftmaxCrossEntropy(logits, targets)
+			logits.Set(row, col, v)
+
+			num := (up - down) / (2 * h) * float64(logits.RowN())
+			if math.Abs(num-grad.At(row, col)) > 1e-6 {
+				t.Errorf("(%d, %d) %v != %v", row, col, grad.At(row, col), num)
+			}
+		}
+	}
+
+	//на месте и без потери точности при больших логитах
+	big := FromRows([][]float64{{1000, 0}, {0, 1000}})
+	loss, big = SoftmaxCrossEntropyTo(big, big, []int{1, 1})
+	if math.Abs(loss-500) > 1e-9 || !big.Equal(FromRows([][]float64{{1, -1}, {0, 0}})) {
+		t.Errorf("%v %v", loss, big.Slice())
+	}
+}
+
+func Test_SoftmaxCrossEntropy_Targets(t *testing.T) {
+	tests := []struct {
+		targets []int
+		err     string
+	}{
+		{[]int{0, 2}, ""},
+		{[]int{0}, "SoftmaxCrossEntropy:"},
+		{[]int{0, -1}, "класс -1 строки 1"},
+		{[]int{3, 0}, "класс 3 строки 0"},
+	}
+
+	for i, test := range tests {
+		logits := randMat(2, 3)
+		for _, loss := range []func() float64{
+			func() float64 { return SoftmaxCrossEntropy(logits, test.targets) },
+			func() float64 { l, _ := SoftmaxCrossEntropyGrad(logits, test.targets); return l },
+		} {
+			err := func() (err error) {
+				defer Catch(&err)
+				loss()
+				return nil
+			}()
+
+			var shapeErr *ShapeError
+			if test.err == "" && err != nil ||
+				test.err != "" && (!errors.As(err, &shapeErr) || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("%d: %v, ожидается %q", i+1, err, test.err)
+			}
+		}
+	}
+}
+
+func Test_Gather(t *testing.T) {
+	m := FromRows([][]float64{{1, 2}, {3, 4}, {5, 6}})
+
+	if g := m.Gather([]int{2, 0, 2}); !g.Equal(FromRows([][]float64{{5, 6}, {1, 2}, {5, 6}})) {
+		t.Errorf("%v", g.Slice())
+	}
+
+	m.ScatterAdd(FromRows([][]float64{{1, 1}, {10, 10}, {1, 1}}), []int{2, 0, 2})
+	if !m.Equal(FromRows([][]float64{{11, 12}, {3, 4}, {7, 8}})) {
+		t.Errorf("%v", m.Slice())
+	}
+}
+
+func Test_ScatterAXPY(t *testing.T) {
+	m := FromRows([][]float64{{1, 2}, {3, 4}, {5, 6}})
+	m.ScatterAXPY(-2, FromRows([][]float64{{1, 1}, {.5, 0}}), []int{1, 1})
+
+	if !m.Equal(FromRows([][]float64{{1, 2}, {0, 2}, {5, 6}})) {
+		t.Errorf("%v", m.Slice())
+	}
+}
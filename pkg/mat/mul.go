@@ -0,0 +1,208 @@
+package mat
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// размеры блоков, в пределах которых данные b остаются в кэше
+const (
+	tileK = 128
+	tileJ = 256
+	tileT = 64
+)
+
+// parallelMin количество умножений, начиная с которого
+// работа делится между горутинами
+const parallelMin = 1 << 16
+
+var workers atomic.Int64
+
+// SetWorkers задаёт количество горутин, между которыми делится умножение матриц.
+// При n < 1 используется runtime.NumCPU().
+func SetWorkers(n int) {
+	workers.Store(int64(max(n, 0)))
+}
+
+func Workers() int {
+	if n := workers.Load(); n > 0 {
+		return int(n)
+	}
+	return runtime.NumCPU()
+}
+
+func (m Mat[T]) Mul(b Mat[T]) Mat[T] {
+	return m.MulTo(New[T](m.RowN(), b.ColN()), b)
+}
+
+// MulTo записывает m * b в dst, dst не должна пересекаться с m и b
+func (m Mat[T]) MulTo(dst, b Mat[T]) Mat[T] {
+	if m.ColN() != b.RowN() {
+		panic(&ShapeError{Op: "Mul", A: m.shape(), B: b.shape()})
+	}
+	checkDst("Mul", dst, m.RowN(), b.ColN())
+
+	run(mulKernel, dst.Zero(), m, b, m.coln*b.coln)
+
+	return dst
+}
+
+// MulT вычисляет m * bT, не транспонируя b
+func (m Mat[T]) MulT(b Mat[T]) Mat[T] {
+	return m.MulTTo(New[T](m.RowN(), b.RowN()), b)
+}
+
+func (m Mat[T]) MulTTo(dst, b Mat[T]) Mat[T] {
+	if m.ColN() != b.ColN() {
+		panic(&ShapeError{Op: "MulT", A: m.shape(), B: b.shape()})
+	}
+	checkDst("MulT", dst, m.RowN(), b.RowN())
+
+	run(mulTKernel, dst, m, b, m.coln*b.rown)
+
+	return dst
+}
+
+// TMul вычисляет mT * b, не транспонируя m
+func (m Mat[T]) TMul(b Mat[T]) Mat[T] {
+	return m.TMulTo(New[T](m.ColN(), b.ColN()), b)
+}
+
+func (m Mat[T]) TMulTo(dst, b Mat[T]) Mat[T] {
+	if m.RowN() != b.RowN() {
+		panic(&ShapeError{Op: "TMul", A: m.shape(), B: b.shape()})
+	}
+	checkDst("TMul", dst, m.ColN(), b.ColN())
+
+	run(tmulKernel, dst.Zero(), m, b, m.rown*b.coln)
+
+	return dst
+}
+
+// kernel вид умножения, строки результата которого делятся между горутинами.
+// Обобщённые функции не передаются значениями, так как это выделяет память.
+type kernel int
+
+const (
+	mulKernel kernel = iota
+	mulTKernel
+	tmulKernel
+)
+
+// kernelRows вычисляет строки [from, to) результата c
+func kernelRows[T Float](k kernel, c, a, b Mat[T], from, to int) {
+	switch k {
+	case mulKernel:
+		mulRows(c, a, b, from, to)
+	case mulTKernel:
+		mulTRows(c, a, b, from, to)
+	case tmulKernel:
+		tmulRows(c, a, b, from, to)
+	}
+}
+
+// run делит строки c между горутинами.
+// rowCost - количество умножений на одну строку c.
+func run[T Float](k kernel, c, a, b Mat[T], rowCost int) {
+	n := min(Workers(), c.rown)
+	if n <= 1 || c.rown*rowCost < parallelMin {
+		kernelRows(k, c, a, b, 0, c.rown)
+		return
+	}
+
+	runParallel(k, c, a, b, n)
+}
+
+func runParallel[T Float](k kernel, c, a, b Mat[T], n int) {
+	chunk := (c.rown + n - 1) / n
+
+	var wg sync.WaitGroup
+	for from := 0; from < c.rown; from += chunk {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			kernelRows(k, c, a, b, from, to)
+		}(from, min(from+chunk, c.rown))
+	}
+	wg.Wait()
+}
+
+// mulRows вычисляет строки [from, to) произведения a * b.
+// Порядок суммирования по k совпадает с наивным умножением.
+func mulRows[T Float](c, a, b Mat[T], from, to int) {
+	for kk := 0; kk < a.coln; kk += tileK {
+		ke := min(kk+tileK, a.coln)
+
+		for jj := 0; jj < b.coln; jj += tileJ {
+			je := min(jj+tileJ, b.coln)
+
+			for row := from; row < to; row++ {
+				crow := c.Row(row)[jj:je]
+				for k, v := range a.Row(row)[kk:ke] {
+					brow := b.Row(kk + k)[jj:je]
+					crow := crow[:len(brow)]
+					for col, bv := range brow {
+						crow[col] += v * bv
+					}
+				}
+			}
+		}
+	}
+}
+
+// mulTRows вычисляет строки [from, to) произведения a * bT
+func mulTRows[T Float](c, a, b Mat[T], from, to int) {
+	for jj := 0; jj < b.rown; jj += tileT {
+		je := min(jj+tileT, b.rown)
+
+		for row := from; row < to; row++ {
+			arow, crow := a.Row(row), c.Row(row)
+
+			//четыре независимые суммы, порядок слагаемых в каждой сохраняется
+			j := jj
+			for ; j+4 <= je; j += 4 {
+				b0 := b.Row(j)[:len(arow)]
+				b1 := b.Row(j + 1)[:len(arow)]
+				b2 := b.Row(j + 2)[:len(arow)]
+				b3 := b.Row(j + 3)[:len(arow)]
+
+				var s0, s1, s2, s3 T
+				for k, v := range arow {
+					s0 += v * b0[k]
+					s1 += v * b1[k]
+					s2 += v * b2[k]
+					s3 += v * b3[k]
+				}
+
+				crow[j], crow[j+1], crow[j+2], crow[j+3] = s0, s1, s2, s3
+			}
+
+			for ; j < je; j++ {
+				brow := b.Row(j)[:len(arow)]
+
+				var sum T
+				for k, v := range arow {
+					sum += v * brow[k]
+				}
+
+				crow[j] = sum
+			}
+		}
+	}
+}
+
+// tmulRows вычисляет строки [from, to) произведения aT * b
+func tmulRows[T Float](c, a, b Mat[T], from, to int) {
+	for row := from; row < to; row++ {
+		crow := c.Row(row)
+		for k := range a.rown {
+			v := a.data[k*a.stride+row]
+			brow := b.Row(k)
+			crow := crow[:len(brow)]
+			for col, bv := range brow {
+				crow[col] += v * bv
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package mat
+
+import "sync"
+
+// Pool хранит освободившиеся буферы для временных матриц
+type Pool[T Float] struct {
+	mu   sync.Mutex
+	free [][]T
+}
+
+// Get возвращает обнулённую матрицу rown x coln,
+// по возможности используя ранее освобождённый буфер
+func (p *Pool[T]) Get(rown, coln int) Mat[T] {
+	n := rown * coln
+
+	p.mu.Lock()
+	best := -1
+	for i, buf := range p.free {
+		if cap(buf) >= n && (best == -1 || cap(buf) < cap(p.free[best])) {
+			best = i
+		}
+	}
+
+	var data []T
+	if best != -1 {
+		data = p.free[best][:n]
+		last := len(p.free) - 1
+		p.free[best], p.free[last] = p.free[last], nil
+		p.free = p.free[:last]
+	}
+	p.mu.Unlock()
+
+	if data == nil {
+		return New[T](rown, coln)
+	}
+
+	clear(data)
+
+	return Mat[T]{
+		data:   data,
+		rown:   rown,
+		coln:   coln,
+		stride: coln,
+	}
+}
+
+// Put возвращает буфер матрицы в пул.
+// После Put матрицу и её представления использовать нельзя.
+func (p *Pool[T]) Put(m Mat[T]) {
+	if cap(m.data) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.free = append(p.free, m.data[:0])
+	p.mu.Unlock()
+}
+
+var (
+	scratch32 Pool[float32]
+	scratch64 Pool[float64]
+)
+
+// scratch возвращает общий пул для типа T
+func scratch[T Float]() *Pool[T] {
+	var p any
+	switch any(T(0)).(type) {
+	case float32:
+		p = &scratch32
+	case float64:
+		p = &scratch64
+	}
+	return p.(*Pool[T])
+}
+
+// Get берёт временную матрицу из общего пула
+func Get[T Float](rown, coln int) Mat[T] {
+	return scratch[T]().Get(rown, coln)
+}
+
+// Put возвращает временную матрицу в общий пул
+func Put[T Float](m Mat[T]) {
+	scratch[T]().Put(m)
+}
@@ -0,0 +1,224 @@
+package mat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// Файл тензоров в формате safetensors:
+// 8 байт длины заголовка (little-endian), JSON заголовок
+// {"имя": {"dtype": "F32", "shape": [строки, столбцы], "data_offsets": [начало, конец]}, "__metadata__": {...}}
+// и данные всех матриц подряд, little-endian, по строкам.
+
+const (
+	dtypeF32 = "F32"
+	dtypeF64 = "F64"
+
+	metaKey = "__metadata__"
+
+	//maxHeaderLen ограничение длины заголовка, как в safetensors
+	maxHeaderLen = 100 << 20
+)
+
+// Tensor матрица и имя, под которым она хранится в файле
+type Tensor[T Float] struct {
+	Name string
+	Mat  *Mat[T]
+}
+
+type tensorInfo struct {
+	DType   string   `json:"dtype"`
+	Shape   [2]int   `json:"shape"`
+	Offsets [2]int64 `json:"data_offsets"`
+}
+
+func dtype[T Float]() string {
+	var v T
+	if _, ok := any(v).(float32); ok {
+		return dtypeF32
+	}
+	return dtypeF64
+}
+
+func dtypeSize(dtype string) (int64, error) {
+	switch dtype {
+	case dtypeF32:
+		return 4, nil
+	case dtypeF64:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("неизвестный dtype %q", dtype)
+}
+
+// WriteTensors записывает матрицы tensors и строковые метаданные meta в w
+func WriteTensors[T Float](w io.Writer, meta map[string]string, tensors []Tensor[T]) error {
+	header := make(map[string]any, len(tensors)+1)
+	if len(meta) != 0 {
+		header[metaKey] = meta
+	}
+
+	size, _ := dtypeSize(dtype[T]())
+
+	var offset int64
+	for _, t := range tensors {
+		if _, ok := header[t.Name]; ok {
+			return fmt.Errorf("WriteTensors: имя %q повторяется", t.Name)
+		}
+
+		n := int64(t.Mat.RowN()*t.Mat.ColN()) * size
+		header[t.Name] = tensorInfo{
+			DType:   dtype[T](),
+			Shape:   t.Mat.shape(),
+			Offsets: [2]int64{offset, offset + n},
+		}
+		offset += n
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	//данные выравниваются по 8 байт пробелами в конце заголовка
+	for len(data)%8 != 0 {
+		data = append(data, ' ')
+	}
+
+	bw := bufio.NewWriter(w)
+
+	err = binary.Write(bw, binary.LittleEndian, uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	if _, err = bw.Write(data); err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, t := range tensors {
+		for row := range t.Mat.RowN() {
+			buf = appendRow(buf[:0], t.Mat.Row(row))
+			if _, err = bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+func appendRow[T Float](buf []byte, row []T) []byte {
+	for _, v := range row {
+		switch v := any(v).(type) {
+		case float32:
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		case float64:
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	}
+	return buf
+}
+
+// ReadTensors читает файл тензоров и приводит все матрицы к типу T
+func ReadTensors[T Float](r io.Reader) (meta map[string]string, mats map[string]Mat[T], err error) {
+	var headerLen uint64
+	if err = binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+		return nil, nil, err
+	}
+
+	if headerLen > maxHeaderLen {
+		return nil, nil, fmt.Errorf("ReadTensors: длина заголовка %d больше %d", headerLen, maxHeaderLen)
+	}
+
+	data := make([]byte, headerLen)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, nil, err
+	}
+
+	var header map[string]json.RawMessage
+	if err = json.Unmarshal(data, &header); err != nil {
+		return nil, nil, err
+	}
+
+	if raw, ok := header[metaKey]; ok {
+		if err = json.Unmarshal(raw, &meta); err != nil {
+			return nil, nil, err
+		}
+		delete(header, metaKey)
+	}
+
+	infos := make(map[string]tensorInfo, len(header))
+	names := make([]string, 0, len(header))
+	for name, raw := range header {
+		var info tensorInfo
+		if err = json.Unmarshal(raw, &info); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		infos[name] = info
+		names = append(names, name)
+	}
+
+	//данные читаются последовательно в порядке смещений,
+	//пустые матрицы идут раньше непустых с тем же началом
+	slices.SortFunc(names, func(a, b string) int {
+		oa, ob := infos[a].Offsets, infos[b].Offsets
+		return slices.Compare(oa[:], ob[:])
+	})
+
+	//размер данных известен только после чтения, поэтому смещения проверяются по нему
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mats = make(map[string]Mat[T], len(infos))
+
+	var offset int64
+	for _, name := range names {
+		info := infos[name]
+
+		size, err := dtypeSize(info.DType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		rown, coln := info.Shape[0], info.Shape[1]
+		if rown < 0 || coln < 0 || coln != 0 && int64(rown) > int64(len(body))/size/int64(coln) {
+			return nil, nil, fmt.Errorf("%s: неверный shape %v", name, info.Shape)
+		}
+		n := int64(rown*coln) * size
+		start, end := info.Offsets[0], info.Offsets[1]
+		if start < offset || end-start != n || end > int64(len(body)) {
+			return nil, nil, fmt.Errorf("%s: неверные data_offsets %v", name, info.Offsets)
+		}
+		offset = end
+
+		buf := body[start:end]
+		m := New[T](rown, coln)
+		for i := range m.data {
+			if info.DType == dtypeF32 {
+				m.data[i] = T(math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+			} else {
+				m.data[i] = T(math.Float64frombits(binary.LittleEndian.Uint64(buf[i*8:])))
+			}
+		}
+		mats[name] = m
+	}
+
+	return meta, mats, nil
+}
+
+// IsTensorFile проверяет, начинается ли r с заголовка файла тензоров.
+// JSON не содержит нулевых байт, а длина заголовка меньше 4 ГБ,
+// поэтому старшие байты длины и '{' после неё однозначно отличают форматы.
+func IsTensorFile(r *bufio.Reader) bool {
+	b, err := r.Peek(9)
+	if err != nil {
+		return false
+	}
+	return b[4] == 0 && b[5] == 0 && b[6] == 0 && b[7] == 0 && b[8] == '{'
+}
@@ -0,0 +1,95 @@
+package mlp
+
+import (
+	"ml/pkg/activation"
+	"ml/pkg/initializer"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// GLU управляемый блок прямого прохода трансформера: Down(Act(Gate(x)) * Up(x)).
+// С Act = SiLU это SwiGLU, с GELU - GeGLU.
+type GLU[T mat.Float] struct {
+	Gate *Layer[T] `json:"gate"`
+	Up   *Layer[T] `json:"up"`
+	Down *Layer[T] `json:"down"`
+	// Act функция активации Gate
+	Act activation.Name `json:"act"`
+	// Alpha параметр LeakyReLU и ELU
+	Alpha float64 `json:"alpha"`
+
+	//Act(Gate(x)) и произведение с Up(x)
+	act, h mat.Mat[T]
+	dx     mat.Mat[T]
+}
+
+var _ nn.Module[float64] = (*GLU[float64])(nil)
+
+func (glu *GLU[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	stage := "gate"
+	defer mat.Rethrow(&stage)
+
+	gate := glu.Gate.Forward(x)
+	stage = "up"
+	up := glu.Up.Forward(x)
+
+	glu.act = activation.ForwardTo(glu.Act, mat.Reuse(glu.act, gate.RowN(), gate.ColN()), gate, glu.Alpha)
+	glu.h = glu.act.MulElwiseTo(mat.Reuse(glu.h, gate.RowN(), gate.ColN()), up)
+
+	stage = "down"
+	return glu.Down.Forward(glu.h)
+}
+
+// Backward dup = dh * Act(gate), dgate = dh * up * Act'(gate)
+func (glu *GLU[T]) Backward(do mat.Mat[T]) mat.Mat[T] {
+	stage := "down"
+	defer mat.Rethrow(&stage)
+
+	dh := glu.Down.Backward(do)
+	rown, coln := dh.RowN(), dh.ColN()
+
+	dup := dh.MulElwiseTo(mat.Get[T](rown, coln), glu.act)
+	dgate := activation.DerTo(glu.Act, mat.Get[T](rown, coln), glu.Gate.ans, glu.Alpha).
+		MulElwiseInPlace(dh).
+		MulElwiseInPlace(glu.Up.ans)
+
+	stage = "up"
+	dx := glu.Up.Backward(dup)
+	glu.dx = mat.Reuse(glu.dx, dx.RowN(), dx.ColN()).Copy(dx)
+	stage = "gate"
+	glu.dx.AddInPlace(glu.Gate.Backward(dgate))
+
+	mat.Put(dup)
+	mat.Put(dgate)
+
+	return glu.dx
+}
+
+// NewGLU создаёт блок со скрытым слоем ширины hidden, веса заполняются init
+func NewGLU[T mat.Float](init initializer.Init, act activation.Name, alpha float64, xrown, xcoln, hidden int) *GLU[T] {
+	return &GLU[T]{
+		Gate:  NewLayer[T](xrown, xcoln, hidden, init),
+		Up:    NewLayer[T](xrown, xcoln, hidden, init),
+		Down:  NewLayer[T](xrown, hidden, xcoln, init),
+		Act:   act,
+		Alpha: alpha,
+	}
+}
+
+// Tensors возвращает матрицы блока с именами для сохранения в файл
+func (glu *GLU[T]) Tensors(prefix string) []mat.Tensor[T] {
+	tensors := glu.Gate.Tensors(prefix + "gate.")
+	tensors = append(tensors, glu.Up.Tensors(prefix+"up.")...)
+	return append(tensors, glu.Down.Tensors(prefix+"down.")...)
+}
+
+// CollapseBias то же, что MLP.CollapseBias
+func (glu *GLU[T]) CollapseBias() int {
+	return max(glu.Gate.CollapseBias(), glu.Up.CollapseBias(), glu.Down.CollapseBias())
+}
+
+func (glu *GLU[T]) Parameters() []*nn.Param[T] {
+	params := nn.Prefix("gate.", glu.Gate.Parameters())
+	params = append(params, nn.Prefix("up.", glu.Up.Parameters())...)
+	return append(params, nn.Prefix("down.", glu.Down.Parameters())...)
+}
@@ -1,90 +1,152 @@
 package mlp
 
 import (
+	"fmt"
+	"go.uber.org/zap"
+	"ml/pkg/activation"
+	"ml/pkg/initializer"
 	"ml/pkg/mat"
 	"ml/pkg/mlutil"
+	"ml/pkg/nn"
 )
 
-type Layer struct {
-	Weight mat.Mat `json:"weight"`
-	Bias   mat.Mat `json:"bias"`
-	x      mat.Mat
-	ans    mat.Mat
+// Layer полносвязный слой x*Weight + Bias.
+// Bias - строка 1 x wcoln, общая для всех строк x.
+type Layer[T mat.Float] struct {
+	Weight mat.Mat[T] `json:"weight"`
+	Bias   mat.Mat[T] `json:"bias"`
+	x      mat.Mat[T]
+	ans    mat.Mat[T]
+	//вход слоя после функции активации
+	act mat.Mat[T]
+	dx  mat.Mat[T]
+	//градиенты, накопленные Backward
+	dweight, dbias mat.Mat[T]
 }
 
-func (l *Layer) Forward(x mat.Mat) mat.Mat {
+var (
+	_ nn.Module[float64] = (*Layer[float64])(nil)
+	_ nn.Module[float64] = (*MLP[float64])(nil)
+)
+
+func (l *Layer[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
 	l.x = x
-	l.ans = l.x.Mul(l.Weight).Add(l.Bias)
+	l.ans = l.x.MulTo(mat.Reuse(l.ans, x.RowN(), l.Weight.ColN()), l.Weight).
+		AddInPlace(l.Bias)
 	return l.ans
 }
 
-func (l *Layer) Backward(dans mat.Mat) (dx, dweight, dbias mat.Mat) {
-	return dans.Mul(l.Weight.T()),
-		l.x.T().Mul(dans),
-		dans
+// Grads возвращает градиенты, не меняя слой
+func (l *Layer[T]) Grads(dans mat.Mat[T]) (dx, dweight, dbias mat.Mat[T]) {
+	return dans.MulT(l.Weight),
+		l.x.TMul(dans),
+		dans.ColSum()
 }
 
-func (l *Layer) BackwardMut(dans mat.Mat, lrate float64) mat.Mat {
-	dx := dans.Mul(l.Weight.T())
-	dweight := l.x.T().Mul(dans)
-	dbias := dans
+func (l *Layer[T]) Backward(dans mat.Mat[T]) mat.Mat[T] {
+	l.dx = dans.MulTTo(mat.Reuse(l.dx, dans.RowN(), l.Weight.RowN()), l.Weight)
 
-	l.Weight = mlutil.Upd(l.Weight, dweight, lrate)
-	l.Bias = mlutil.Upd(l.Bias, dbias, lrate)
+	dweight := l.x.TMulTo(mat.Get[T](l.Weight.RowN(), l.Weight.ColN()), dans)
+	dbias := dans.ColSumTo(mat.Get[T](1, dans.ColN()))
+	nn.Accumulate(&l.dweight, dweight)
+	nn.Accumulate(&l.dbias, dbias)
+	mat.Put(dweight)
+	mat.Put(dbias)
 
+	return l.dx
+}
+
+// BackwardMut вычисляет градиенты и сразу обновляет веса, как до разделения Backward и Step.
+//
+// Deprecated: используйте Backward и nn.Step
+func (l *Layer[T]) BackwardMut(dans mat.Mat[T], lrate float64) mat.Mat[T] {
+	params := l.Parameters()
+	dx := l.Backward(dans)
+	nn.Step(params, lrate)
+	nn.ZeroGrad(params)
 	return dx
 }
 
-func (l *Layer) Update(dweight, dbias mat.Mat, lrate float64) {
-	l.Weight = l.Weight.
-		Sub(dweight.Scale(lrate))
+func (l *Layer[T]) Update(dweight, dbias mat.Mat[T], lrate float64) {
+	l.Weight = mlutil.Upd(l.Weight, dweight, lrate)
+	l.Bias = mlutil.Upd(l.Bias, dbias, lrate)
+}
 
-	l.Bias = l.Bias.
-		Sub(dbias.Scale(lrate))
+// NewLayer создаёт слой с нулевым смещением.
+// Необязательный init заполняет Weight, по умолчанию initializer.HeNormal.
+// Слой принимает любое число строк, xrown оставлен для совместимости и не используется.
+func NewLayer[T mat.Float](xrown, xcoln, wcoln int, init ...initializer.Init) *Layer[T] {
+	return &Layer[T]{
+		Weight: initializer.New[T](xcoln, wcoln, initializer.Pick(init, initializer.HeNormal)),
+		Bias:   mat.New[T](1, wcoln),
+	}
 }
 
-func NewLayer(xrown, xcoln, wcoln int) *Layer {
-	return &Layer{
-		Weight: mat.New(xcoln, wcoln).Rand(),
-		Bias:   mat.New(xrown, wcoln),
+// CollapseBias усредняет по строкам смещение xrown x wcoln моделей,
+// сохранённых до общего смещения. Возвращает прежнее число строк, 1 - менять нечего.
+func (l *Layer[T]) CollapseBias() int {
+	rown := l.Bias.RowN()
+	if rown <= 1 {
+		return rown
 	}
+	l.Bias = l.Bias.T().Mean().T()
+	return rown
 }
 
-type MLP struct {
-	Lays  []*Layer `json:"lays"`
-	Alpha float64  `json:"alpha"`
+type MLP[T mat.Float] struct {
+	Lays []*Layer[T] `json:"lays"`
+	// Act функция активации между слоями, по умолчанию LeakyReLU
+	Act activation.Name `json:"act,omitempty"`
+	// Alpha параметр LeakyReLU и ELU
+	Alpha float64 `json:"alpha"`
 }
 
-func (mlp *MLP) Forward(x mat.Mat) mat.Mat {
-	for i, l := range mlp.Lays {
-		if i != 0 {
-			x = x.LeakyReLU(mlp.Alpha)
-		}
+// act возвращает функцию активации, модели без поля act использовали LeakyReLU
+func (mlp *MLP[T]) act() activation.Name {
+	if mlp.Act == "" {
+		return activation.LeakyReLU
+	}
+	return mlp.Act
+}
 
-		x = l.Forward(x)
+func (mlp *MLP[T]) Forward(x mat.Mat[T]) mat.Mat[T] {
+	for i := range mlp.Lays {
+		x = mlp.forward(i, x)
 	}
 
 	return x
 }
 
-type DLayer struct {
-	Weight mat.Mat `json:"weight"`
-	Bias   mat.Mat `json:"bias"`
+func (mlp *MLP[T]) forward(i int, x mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("lay", i)
+
+	l := mlp.Lays[i]
+	if i != 0 {
+		l.act = activation.ForwardTo(mlp.act(), mat.Reuse(l.act, x.RowN(), x.ColN()), x, mlp.Alpha)
+		x = l.act
+	}
+
+	return l.Forward(x)
+}
+
+type DLayer[T mat.Float] struct {
+	Weight mat.Mat[T] `json:"weight"`
+	Bias   mat.Mat[T] `json:"bias"`
 }
 
-func (mlp *MLP) Backward(dans mat.Mat) []DLayer {
-	dlays := make([]DLayer, len(mlp.Lays))
+// Grads возвращает градиенты всех слоёв, не меняя MLP
+func (mlp *MLP[T]) Grads(dans mat.Mat[T]) []DLayer[T] {
+	dlays := make([]DLayer[T], len(mlp.Lays))
 
 	for i := len(mlp.Lays) - 1; i >= 0; i-- {
-		var dweight, dbias mat.Mat
+		var dweight, dbias mat.Mat[T]
 
-		dans, dweight, dbias = mlp.Lays[i].Backward(dans)
+		dans, dweight, dbias = mlp.Lays[i].Grads(dans)
 
-		dlays[i] = DLayer{Weight: dweight, Bias: dbias}
+		dlays[i] = DLayer[T]{Weight: dweight, Bias: dbias}
 
 		if i != 0 {
-			dans = mlp.Lays[i-1].ans.
-				LeakyReLUDer(mlp.Alpha).
+			dans = activation.Der(mlp.act(), mlp.Lays[i-1].ans, mlp.Alpha).
 				MulElwise(dans)
 		}
 	}
@@ -92,33 +154,119 @@ func (mlp *MLP) Backward(dans mat.Mat) []DLayer {
 	return dlays
 }
 
-func (mlp *MLP) BackwardMut(dans mat.Mat, lrate float64) mat.Mat {
+func (mlp *MLP[T]) Backward(dans mat.Mat[T]) mat.Mat[T] {
 	for i := len(mlp.Lays) - 1; i >= 0; i-- {
-		dans = mlp.Lays[i].BackwardMut(dans, lrate)
+		dans = mlp.backward(i, dans)
+	}
 
-		if i != 0 {
-			dans = mlp.Lays[i-1].ans.
-				LeakyReLUDer(mlp.Alpha).
-				MulElwise(dans)
-		}
+	return dans
+}
+
+// BackwardMut вычисляет градиенты и сразу обновляет веса, как до разделения Backward и Step.
+//
+// Deprecated: используйте Backward и nn.Step
+func (mlp *MLP[T]) BackwardMut(dans mat.Mat[T], lrate float64) mat.Mat[T] {
+	params := mlp.Parameters()
+	dx := mlp.Backward(dans)
+	nn.Step(params, lrate)
+	nn.ZeroGrad(params)
+	return dx
+}
+
+func (mlp *MLP[T]) backward(i int, dans mat.Mat[T]) mat.Mat[T] {
+	defer mat.RethrowAt("lay", i)
+
+	dans = mlp.Lays[i].Backward(dans)
+
+	if i != 0 {
+		der := activation.DerTo(mlp.act(), mat.Get[T](dans.RowN(), dans.ColN()),
+			mlp.Lays[i-1].ans, mlp.Alpha)
+		dans = dans.MulElwiseTo(dans, der)
+		mat.Put(der)
 	}
 
 	return dans
 }
 
-func (mlp *MLP) Update(dlays []DLayer, lrate float64) {
+func (mlp *MLP[T]) Update(dlays []DLayer[T], lrate float64) {
 	for i, dlay := range dlays {
 		mlp.Lays[i].Update(dlay.Weight, dlay.Bias, lrate)
 	}
 }
 
-func New(alpha float64, xrown, xcoln int, wcolns ...int) *MLP {
-	mlp := &MLP{Alpha: alpha}
+func New[T mat.Float](alpha float64, xrown, xcoln int, wcolns ...int) *MLP[T] {
+	return NewInit[T](initializer.HeNormal, alpha, xrown, xcoln, wcolns...)
+}
+
+// NewInit то же, что New, веса всех слоёв заполняются init
+func NewInit[T mat.Float](init initializer.Init, alpha float64, xrown, xcoln int, wcolns ...int) *MLP[T] {
+	mlp := &MLP[T]{Act: activation.LeakyReLU, Alpha: alpha}
 
 	for _, wcoln := range wcolns {
-		mlp.Lays = append(mlp.Lays, NewLayer(xrown, xcoln, wcoln))
+		mlp.Lays = append(mlp.Lays, NewLayer[T](xrown, xcoln, wcoln, init))
 		xcoln = wcoln
 	}
 
 	return mlp
 }
+
+// Tensors возвращает матрицы слоя с именами для сохранения в файл
+func (l *Layer[T]) Tensors(prefix string) []mat.Tensor[T] {
+	return []mat.Tensor[T]{
+		{Name: prefix + "weight", Mat: &l.Weight},
+		{Name: prefix + "bias", Mat: &l.Bias},
+	}
+}
+
+func (mlp *MLP[T]) Tensors(prefix string) []mat.Tensor[T] {
+	var tensors []mat.Tensor[T]
+	for i, l := range mlp.Lays {
+		tensors = append(tensors, l.Tensors(fmt.Sprintf("%slays.%d.", prefix, i))...)
+	}
+	return tensors
+}
+
+func (l *Layer[T]) Parameters() []*nn.Param[T] {
+	return []*nn.Param[T]{
+		{Name: "weight", Value: &l.Weight, Grad: &l.dweight},
+		{Name: "bias", Value: &l.Bias, Grad: &l.dbias},
+	}
+}
+
+// CollapseBias вызывает Layer.CollapseBias всех слоёв и возвращает наибольшее прежнее число строк
+func (mlp *MLP[T]) CollapseBias() int {
+	var rown int
+	for _, l := range mlp.Lays {
+		rown = max(rown, l.CollapseBias())
+	}
+	return rown
+}
+
+// Collapser слой, сеть или блок с методом CollapseBias
+type Collapser interface {
+	CollapseBias() int
+}
+
+// CollapseBias усредняет смещения всех nets и возвращает наибольшее прежнее число строк
+func CollapseBias(nets ...Collapser) int {
+	var rown int
+	for _, n := range nets {
+		rown = max(rown, n.CollapseBias())
+	}
+	return rown
+}
+
+// WarnBias предупреждает, что смещения модели из src были из rown строк и усреднены
+func WarnBias(src string, rown int) {
+	if rown > 1 {
+		zap.S().Warnf("%s: смещения из %d строк усреднены в одну, сохраните модель заново", src, rown)
+	}
+}
+
+func (mlp *MLP[T]) Parameters() []*nn.Param[T] {
+	var params []*nn.Param[T]
+	for i, l := range mlp.Lays {
+		params = append(params, nn.Prefix(fmt.Sprintf("lays.%d.", i), l.Parameters())...)
+	}
+	return params
+}
@@ -1,8 +1,13 @@
 package mlp
 
 import (
+	"encoding/json"
+	"math"
+	"ml/pkg/activation"
+	"ml/pkg/gradcheck"
+	"ml/pkg/initializer"
 	"ml/pkg/mat"
-	"reflect"
+	"ml/pkg/nn"
 	"testing"
 )
 
@@ -28,11 +33,11 @@ func Test_NewLayer(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		l := NewLayer(test.xrown, test.xcoln, test.wcoln)
+		l := NewLayer[float64](test.xrown, test.xcoln, test.wcoln)
 
-		if l.Bias.RowN() != test.xrown || l.Bias.ColN() != test.wcoln {
-			t.Errorf("%d: bias %dx%d, правильный ответ %dx%d",
-				i+1, l.Bias.RowN(), l.Bias.ColN(), test.xrown, test.wcoln)
+		if l.Bias.RowN() != 1 || l.Bias.ColN() != test.wcoln {
+			t.Errorf("%d: bias %dx%d, правильный ответ 1x%d",
+				i+1, l.Bias.RowN(), l.Bias.ColN(), test.wcoln)
 		}
 
 		if l.Weight.RowN() != test.xcoln || l.Weight.ColN() != test.wcoln {
@@ -44,91 +49,269 @@ func Test_NewLayer(t *testing.T) {
 
 func Test_Layer_Forward(t *testing.T) {
 	tests := []struct {
-		l      *Layer
-		x, ans mat.Mat
+		l      *Layer[float64]
+		x, ans mat.Mat[float64]
 	}{
 		{
-			x: mat.Mat{{.5, 1, 3}},
-			l: &Layer{
-				Weight: mat.Mat{
+			x: mat.FromRows([][]float64{{.5, 1, 3}}),
+			l: &Layer[float64]{
+				Weight: mat.FromRows([][]float64{
 					{5, 3},
 					{.5, 1},
 					{10, 5},
-				},
-				Bias: mat.Mat{{0, 0}},
+				}),
+				Bias: mat.FromRows([][]float64{{0, 0}}),
 			},
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{33, 17.5},
-			},
+			}),
 		},
 		{
-			x: mat.Mat{{.5, 1, 3}},
-			l: &Layer{
-				Weight: mat.Mat{
+			x: mat.FromRows([][]float64{{.5, 1, 3}}),
+			l: &Layer[float64]{
+				Weight: mat.FromRows([][]float64{
 					{5, 3},
 					{.5, 1},
 					{10, 5},
-				},
-				Bias: mat.Mat{{5, 3}},
+				}),
+				Bias: mat.FromRows([][]float64{{5, 3}}),
 			},
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{38, 20.5},
-			},
+			}),
 		},
 		{
-			x: mat.Mat{{.5, 1, 0}},
-			l: &Layer{
-				Weight: mat.Mat{
+			x: mat.FromRows([][]float64{{.5, 1, 0}}),
+			l: &Layer[float64]{
+				Weight: mat.FromRows([][]float64{
 					{0, 3},
 					{.5, 1},
 					{10, 0},
-				},
-				Bias: mat.Mat{{0, 0}},
+				}),
+				Bias: mat.FromRows([][]float64{{0, 0}}),
 			},
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{0.5, 2.5},
-			},
+			}),
 		},
 		{
-			x: mat.Mat{{.5, 1, 0}},
-			l: &Layer{
-				Weight: mat.Mat{
+			x: mat.FromRows([][]float64{{.5, 1, 0}}),
+			l: &Layer[float64]{
+				Weight: mat.FromRows([][]float64{
 					{0, 3},
 					{.5, 1},
 					{10, 0},
-				},
-				Bias: mat.Mat{{.5, -.3}},
+				}),
+				Bias: mat.FromRows([][]float64{{.5, -.3}}),
 			},
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{1, 2.2},
-			},
+			}),
 		},
 		{
-			x: mat.Mat{{.5, 1, 0}},
-			l: &Layer{
-				Weight: mat.Mat{
+			x: mat.FromRows([][]float64{{.5, 1, 0}}),
+			l: &Layer[float64]{
+				Weight: mat.FromRows([][]float64{
 					{0, 3},
 					{.5, -1},
 					{10, 0},
-				},
-				Bias: mat.Mat{{.5, -.3}},
+				}),
+				Bias: mat.FromRows([][]float64{{.5, -.3}}),
 			},
-			ans: mat.Mat{
+			ans: mat.FromRows([][]float64{
 				{1, 0.2},
-			},
+			}),
 		},
 	}
 
 	for i, test := range tests {
 		ans := test.l.Forward(test.x)
-		if !reflect.DeepEqual(ans, test.ans) {
+		if !ans.Equal(test.ans) {
 			t.Errorf("%d: %v != %v", i+1, ans, test.ans)
 		}
 	}
 }
 
 func Test_Layer_Backward(t *testing.T) {
+	l := NewLayer[float64](2, 3, 4, initializer.XavierNormal)
+	x, r := mat.New[float64](2, 3).Rand(), mat.New[float64](2, 4).Rand()
+	l.Bias.Copy(mat.New[float64](1, 4).Rand())
+
+	loss := func() float64 {
+		return gradcheck.Dot(l.Forward(x), r)
+	}
+
+	backward := func() mat.Mat[float64] {
+		return l.Backward(r)
+	}
+
+	results := gradcheck.Params(loss, backward, l.Parameters(), &x)
+	if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+		t.Errorf("%s", gradcheck.Report(failed))
+	}
+}
+
+func Test_Layer_Rows(t *testing.T) {
+	l := NewLayer[float64](2, 2, 2)
+	l.Weight.Copy(mat.FromRows([][]float64{{1, 0}, {0, 1}}))
+	l.Bias.Copy(mat.FromRows([][]float64{{1, -1}}))
+
+	//смещение одно для любого числа строк, его градиент - сумма по строкам
+	for rown := 1; rown <= 3; rown++ {
+		x := mat.New[float64](rown, 2)
+		if ans := l.Forward(x); ans.RowN() != rown || !ans.Rows(rown-1, rown).Equal(l.Bias) {
+			t.Errorf("%d: %v", rown, ans.Slice())
+		}
+
+		l.Backward(mat.New[float64](rown, 2).AddInPlace(mat.FromRows([][]float64{{1, 2}})))
+		if !l.dbias.Equal(mat.FromRows([][]float64{{float64(rown), float64(2 * rown)}})) {
+			t.Errorf("%d: %v", rown, l.dbias.Slice())
+		}
+		nn.ZeroGrad(l.Parameters())
+	}
+}
+
+func Test_CollapseBias(t *testing.T) {
+	tests := []struct {
+		bias, want mat.Mat[float64]
+		rown       int
+	}{
+		{mat.FromRows([][]float64{{1, 2}}), mat.FromRows([][]float64{{1, 2}}), 1},
+		{mat.FromRows([][]float64{{1, 2}, {3, -2}}), mat.FromRows([][]float64{{2, 0}}), 2},
+		{mat.FromRows([][]float64{{1}, {2}, {6}}), mat.FromRows([][]float64{{3}}), 3},
+	}
+
+	for i, test := range tests {
+		l := &Layer[float64]{Bias: test.bias}
+		if rown := l.CollapseBias(); rown != test.rown || !l.Bias.Equal(test.want) {
+			t.Errorf("%d: %d %v != %v", i+1, rown, l.Bias.Slice(), test.want.Slice())
+		}
+	}
 }
 
 func Test_Layer_Update(t *testing.T) {
 }
+
+func Test_MLP_Allocs(t *testing.T) {
+	mat.SetWorkers(1)
+	defer mat.SetWorkers(0)
+
+	mlp := New[float64](.01, 4, 8, 16, 3)
+	x := mat.New[float64](4, 8).Rand()
+	dans := mat.New[float64](4, 3).Rand()
+
+	params := mlp.Parameters()
+	step := func() {
+		mlp.Forward(x)
+		mlp.Backward(dans)
+		nn.Step(params, .001)
+		nn.ZeroGrad(params)
+	}
+
+	//первый шаг выделяет буферы слоёв
+	step()
+
+	if n := testing.AllocsPerRun(10, step); n != 0 {
+		t.Errorf("%.1f выделений памяти на шаг", n)
+	}
+}
+
+func Test_MLP_Float32(t *testing.T) {
+	m64 := New[float64](.01, 2, 5, 7, 3)
+	m32 := &MLP[float32]{Alpha: m64.Alpha}
+	for _, l := range m64.Lays {
+		m32.Lays = append(m32.Lays, &Layer[float32]{
+			Weight: mat.Convert[float32](l.Weight),
+			Bias:   mat.Convert[float32](l.Bias),
+		})
+	}
+
+	x, dans := mat.New[float64](2, 5).Rand(), mat.New[float64](2, 3).Rand()
+
+	for range 3 {
+		ans64 := m64.Forward(x)
+		ans32 := m32.Forward(mat.Convert[float32](x))
+
+		for row := range ans64.RowN() {
+			for col := range ans64.ColN() {
+				if math.Abs(ans64.At(row, col)-float64(ans32.At(row, col))) > 1e-4 {
+					t.Fatalf("%v != %v", ans64.Slice(), ans32.Slice())
+				}
+			}
+		}
+
+		m64.Backward(dans)
+		m32.Backward(mat.Convert[float32](dans))
+		nn.Step(m64.Parameters(), .1)
+		nn.Step(m32.Parameters(), .1)
+		nn.ZeroGrad(m64.Parameters())
+		nn.ZeroGrad(m32.Parameters())
+	}
+}
+
+func Test_MLP_GradCheck(t *testing.T) {
+	for _, act := range activation.Names {
+		mlp := New[float64](.1, 2, 3, 5, 4)
+		mlp.Act = act
+		x, r := mat.New[float64](2, 3).Rand(), mat.New[float64](2, 4).Rand()
+
+		loss := func() float64 {
+			return gradcheck.Dot(mlp.Forward(x), r)
+		}
+
+		backward := func() mat.Mat[float64] {
+			return mlp.Backward(r)
+		}
+
+		results := gradcheck.Params(loss, backward, mlp.Parameters(), &x)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%s:\n%s", act, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_GLU_GradCheck(t *testing.T) {
+	for _, act := range activation.Names {
+		glu := NewGLU[float64](initializer.XavierNormal, act, .1, 2, 3, 5)
+		for _, p := range glu.Parameters() {
+			p.Value.Copy(mat.New[float64](p.Value.RowN(), p.Value.ColN()).Rand())
+		}
+		x, r := mat.New[float64](2, 3).Rand(), mat.New[float64](2, 3).Rand()
+
+		loss := func() float64 {
+			return gradcheck.Dot(glu.Forward(x), r)
+		}
+
+		backward := func() mat.Mat[float64] {
+			return glu.Backward(r)
+		}
+
+		results := gradcheck.Params(loss, backward, glu.Parameters(), &x)
+		if failed := gradcheck.Failed(results, 1e-6); len(failed) != 0 {
+			t.Errorf("%s:\n%s", act, gradcheck.Report(failed))
+		}
+	}
+}
+
+func Test_MLP_Act_JSON(t *testing.T) {
+	mlp := New[float64](.01, 1, 3, 2)
+	mlp.Act = activation.GELUTanh
+
+	data, err := json.Marshal(mlp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded MLP[float64]
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Act != activation.GELUTanh {
+		t.Errorf("%v != %v", loaded.Act, activation.GELUTanh)
+	}
+
+	//модели без поля act используют LeakyReLU
+	if (&MLP[float64]{}).act() != activation.LeakyReLU {
+		t.Errorf("%v", (&MLP[float64]{}).act())
+	}
+}
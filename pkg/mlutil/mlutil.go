@@ -7,8 +7,9 @@ import (
 	"ml/pkg/mat"
 )
 
-func Upd(x, dx mat.Mat, lrate float64) mat.Mat {
-	return x.Sub(dx.Scale(lrate))
+// Upd обновляет x на месте: x -= lrate*dx
+func Upd[T mat.Float](x, dx mat.Mat[T], lrate float64) mat.Mat[T] {
+	return x.AXPY(T(-lrate), dx)
 }
 
 func Shuffle[T any](sl []T) {
@@ -18,7 +19,7 @@ func Shuffle[T any](sl []T) {
 	}
 }
 
-func Img2vec(r io.Reader) mat.Mat {
+func Img2vec(r io.Reader) mat.Mat[float64] {
 	jpg, err := jpeg.Decode(r)
 	if err != nil {
 		panic(err)
@@ -27,7 +28,7 @@ func Img2vec(r io.Reader) mat.Mat {
 	maxY := jpg.Bounds().Max.Y
 	maxX := jpg.Bounds().Max.X
 
-	m := mat.New(1, maxX*maxY)
+	m := mat.New[float64](1, maxX*maxY)
 
 	for y := range maxY {
 		for x := range maxX {
@@ -35,7 +36,7 @@ func Img2vec(r io.Reader) mat.Mat {
 
 			fr, fg, fb := float64(r>>8), float64(g>>8), float64(b>>8)
 
-			m[0][x+(y*maxX)] = (.3*fr + .585*fg + .115*fb) / 255
+			m.Set(0, x+(y*maxX), (.3*fr+.585*fg+.115*fb)/255)
 		}
 	}
 
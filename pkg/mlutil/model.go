@@ -0,0 +1,99 @@
+package mlutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"ml/pkg/mat"
+	"os"
+)
+
+// metaModel ключ метаданных, под которым хранится JSON модели без матриц
+const metaModel = "model"
+
+// SaveModel сохраняет model в файл тензоров to.
+// Матрицы tensors пишутся в двоичном виде, остальные поля model - в JSON в метаданных.
+func SaveModel[T mat.Float](to string, model any, tensors []mat.Tensor[T]) error {
+	//на время кодирования JSON матрицы убираются из модели
+	saved := make([]mat.Mat[T], len(tensors))
+	for i, t := range tensors {
+		saved[i], *t.Mat = *t.Mat, mat.Mat[T]{}
+	}
+	skeleton, err := json.Marshal(model)
+	for i, t := range tensors {
+		*t.Mat = saved[i]
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = mat.WriteTensors(file, map[string]string{metaModel: string(skeleton)}, tensors)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// LoadModel загружает model из src.
+// Формат определяется автоматически: файл тензоров или JSON.
+// tensors вызывается после загрузки JSON части, когда известно устройство модели.
+func LoadModel[T mat.Float](src string, model any, tensors func() []mat.Tensor[T]) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	if !mat.IsTensorFile(r) {
+		return json.
+			NewDecoder(r).
+			Decode(model)
+	}
+
+	meta, mats, err := mat.ReadTensors[T](r)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal([]byte(meta[metaModel]), model)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tensors() {
+		m, ok := mats[t.Name]
+		if !ok {
+			return fmt.Errorf("%s: нет тензора %s", src, t.Name)
+		}
+		*t.Mat = m
+	}
+
+	return nil
+}
+
+// SaveJSON сохраняет model в JSON, как до появления файлов тензоров
+func SaveJSON(to string, model any) error {
+	file, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = json.
+		NewEncoder(file).
+		Encode(model)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
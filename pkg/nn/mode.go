@@ -0,0 +1,19 @@
+package nn
+
+import "sync/atomic"
+
+var training atomic.Bool
+
+// Train включает (on = true) или выключает режим обучения и возвращает прежний режим.
+// В режиме обучения действует dropout, по умолчанию модели работают в режиме вывода.
+// Режим общий для всех моделей, обучение включает его на время работы:
+//
+//	defer nn.Train(nn.Train(true))
+func Train(on bool) bool {
+	return training.Swap(on)
+}
+
+// Training true в режиме обучения
+func Training() bool {
+	return training.Load()
+}
@@ -0,0 +1,175 @@
+// Package nn общий интерфейс слоёв.
+// Оптимизаторы, сохранение, заморозка и подсчёт параметров
+// работают со списком Parameters и не зависят от устройства модели.
+package nn
+
+import (
+	"fmt"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/mlutil"
+	"slices"
+)
+
+// Param обучаемая матрица слоя и её градиент.
+// Value и Grad указывают на поля слоя, поэтому Param видит изменения после Backward.
+type Param[T mat.Float] struct {
+	// Name путь до матрицы, как в Tensors, например "layers.0.mha.out"
+	Name  string
+	Value *mat.Mat[T]
+	// Grad сумма градиентов ошибки по Value после последнего ZeroGrad.
+	// Размер как у Value, пуст до первого Backward.
+	Grad *mat.Mat[T]
+	// Rows отсортированные строки Grad, которые могут быть ненулевыми.
+	// nil у плотных параметров, у таблиц векторов - номера встреченных токенов.
+	Rows *[]int
+}
+
+// Trainable слой с обучаемыми параметрами
+type Trainable[T mat.Float] interface {
+	Parameters() []*Param[T]
+}
+
+// Module слой с прямым и обратным проходом.
+// Слои, принимающие номера токенов (embedding.Embedding, llm.LLM), реализуют только Trainable.
+type Module[T mat.Float] interface {
+	Trainable[T]
+	Forward(x mat.Mat[T]) mat.Mat[T]
+	// Backward прибавляет градиенты по do ответа последнего Forward к Grad параметров
+	// и возвращает градиент по x. Параметры не меняются, их обновляет Step.
+	Backward(do mat.Mat[T]) mat.Mat[T]
+}
+
+// Accumulate прибавляет g к градиенту grad, пустой grad создаётся
+func Accumulate[T mat.Float](grad *mat.Mat[T], g mat.Mat[T]) {
+	*grad = mat.Reuse(*grad, g.RowN(), g.ColN()).AddInPlace(g)
+}
+
+// AccumulateRows добавляет номера строк ids к Rows разреженного градиента
+func AccumulateRows(rows *[]int, ids []int) {
+	all := append(*rows, ids...)
+	slices.Sort(all)
+	*rows = slices.Compact(all)
+}
+
+// Step обновляет параметры градиентным спуском: Value -= lrate*Grad.
+// У разреженных параметров меняются только строки Rows.
+func Step[T mat.Float](params []*Param[T], lrate float64) {
+	for _, p := range params {
+		switch {
+		case p.Grad.RowN() == 0:
+		case p.Rows != nil:
+			for _, row := range *p.Rows {
+				mlutil.Upd(p.Value.Rows(row, row+1), p.Grad.Rows(row, row+1), lrate)
+			}
+		default:
+			*p.Value = mlutil.Upd(*p.Value, *p.Grad, lrate)
+		}
+	}
+}
+
+// ZeroGrad обнуляет градиенты перед следующим шагом
+func ZeroGrad[T mat.Float](params []*Param[T]) {
+	for _, p := range params {
+		if p.Rows == nil {
+			p.Grad.Zero()
+			continue
+		}
+		for _, row := range *p.Rows {
+			clear(p.Grad.Row(row))
+		}
+		*p.Rows = (*p.Rows)[:0]
+	}
+}
+
+// GradNorm общая L2 норма градиентов всех params
+func GradNorm[T mat.Float](params []*Param[T]) float64 {
+	var sum float64
+	for _, p := range params {
+		eachGrad(p, func(g mat.Mat[T]) {
+			sum += g.SquareSum()
+		})
+	}
+	return math.Sqrt(sum)
+}
+
+// ClipGrad уменьшает градиенты params в одно и то же число раз,
+// чтобы их общая норма не превышала maxNorm. Возвращает норму до ограничения.
+func ClipGrad[T mat.Float](params []*Param[T], maxNorm float64) float64 {
+	norm := GradNorm(params)
+	if !(norm > maxNorm) {
+		return norm
+	}
+
+	scale := T(maxNorm / norm)
+	for _, p := range params {
+		eachGrad(p, func(g mat.Mat[T]) {
+			g.ScaleInPlace(scale)
+		})
+	}
+	return norm
+}
+
+// NonFiniteGrad первый параметр, градиент которого содержит NaN или ±Inf, или nil
+func NonFiniteGrad[T mat.Float](params []*Param[T]) *Param[T] {
+	for _, p := range params {
+		finite := true
+		eachGrad(p, func(g mat.Mat[T]) {
+			finite = finite && g.Finite()
+		})
+		if !finite {
+			return p
+		}
+	}
+	return nil
+}
+
+// eachGrad вызывает f для градиента p, у разреженных параметров - для каждой строки Rows
+func eachGrad[T mat.Float](p *Param[T], f func(g mat.Mat[T])) {
+	if p.Rows == nil {
+		f(*p.Grad)
+		return
+	}
+	for _, row := range *p.Rows {
+		f(p.Grad.Rows(row, row+1))
+	}
+}
+
+// CheckNames возвращает ошибку, если имена params повторяются.
+// Оптимизаторы и optim.Trainer хранят состояние по имени, повтор смешал бы состояние двух матриц.
+func CheckNames[T mat.Float](params []*Param[T]) error {
+	seen := make(map[string]bool, len(params))
+	for _, p := range params {
+		if seen[p.Name] {
+			return fmt.Errorf("nn: имя параметра %q повторяется, добавьте nn.Prefix", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// Prefix добавляет prefix к именам params вложенного слоя
+func Prefix[T mat.Float](prefix string, params []*Param[T]) []*Param[T] {
+	for _, p := range params {
+		p.Name = prefix + p.Name
+	}
+	return params
+}
+
+// Count число обучаемых чисел
+func Count[T mat.Float](params []*Param[T]) int {
+	var n int
+	for _, p := range params {
+		n += p.Value.RowN() * p.Value.ColN()
+	}
+	return n
+}
+
+// Tensors значения параметров с именами для сохранения в файл
+func Tensors[T mat.Float](params []*Param[T]) []mat.Tensor[T] {
+	tensors := make([]mat.Tensor[T], len(params))
+	for i, p := range params {
+		tensors[i] = mat.Tensor[T]{Name: p.Name, Mat: p.Value}
+	}
+	return tensors
+}
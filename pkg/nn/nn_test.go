@@ -0,0 +1,124 @@
+package nn
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"testing"
+)
+
+func Test_Params(t *testing.T) {
+	a, b := mat.New[float64](2, 3), mat.New[float64](1, 4)
+	params := Prefix("lay.", []*Param[float64]{
+		{Name: "a", Value: &a},
+		{Name: "b", Value: &b},
+	})
+
+	if n := Count(params); n != 10 {
+		t.Errorf("%d != 10", n)
+	}
+
+	tensors := Tensors(params)
+	for i, name := range []string{"lay.a", "lay.b"} {
+		if params[i].Name != name || tensors[i].Name != name || tensors[i].Mat != params[i].Value {
+			t.Errorf("%d: %s != %s", i, tensors[i].Name, name)
+		}
+	}
+}
+
+func Test_Step(t *testing.T) {
+	dense, sparse := mat.FromRows([][]float64{{1, 2}}), mat.FromRows([][]float64{{1}, {2}, {3}})
+	var ddense, dsparse mat.Mat[float64]
+	rows := []int{}
+	params := []*Param[float64]{
+		{Name: "dense", Value: &dense, Grad: &ddense},
+		{Name: "sparse", Value: &sparse, Grad: &dsparse, Rows: &rows},
+	}
+
+	//два примера накапливаются в одном шаге
+	for range 2 {
+		Accumulate(&ddense, mat.FromRows([][]float64{{1, -1}}))
+		Accumulate(&dsparse, mat.FromRows([][]float64{{0}, {0}, {1}}))
+		AccumulateRows(&rows, []int{2})
+	}
+	Step(params, .5)
+	ZeroGrad(params)
+
+	if !dense.Equal(mat.FromRows([][]float64{{0, 3}})) || !sparse.Equal(mat.FromRows([][]float64{{1}, {2}, {2}})) {
+		t.Errorf("%v %v", dense.Slice(), sparse.Slice())
+	}
+	if len(rows) != 0 || !ddense.Equal(mat.New[float64](1, 2)) || !dsparse.Equal(mat.New[float64](3, 1)) {
+		t.Errorf("%v %v %v", rows, ddense.Slice(), dsparse.Slice())
+	}
+}
+
+func Test_CheckNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		err   bool
+	}{
+		{nil, false},
+		{[]string{"a", "b"}, false},
+		{[]string{"a", "b", "a"}, true},
+	}
+
+	for i, test := range tests {
+		var params []*Param[float64]
+		for _, name := range test.names {
+			params = append(params, &Param[float64]{Name: name})
+		}
+		if err := CheckNames(params); (err != nil) != test.err {
+			t.Errorf("%d: %v", i+1, err)
+		}
+	}
+}
+
+func Test_ClipGrad(t *testing.T) {
+	dense, sparse := mat.New[float64](1, 1), mat.New[float64](2, 1)
+	ddense, dsparse := mat.FromRows([][]float64{{3}}), mat.FromRows([][]float64{{math.NaN()}, {4}})
+	rows := []int{1}
+	params := []*Param[float64]{
+		{Name: "dense", Value: &dense, Grad: &ddense},
+		{Name: "sparse", Value: &sparse, Grad: &dsparse, Rows: &rows},
+	}
+
+	//строки не из Rows не учитываются
+	if p := NonFiniteGrad(params); p != nil {
+		t.Errorf("%s", p.Name)
+	}
+
+	tests := []struct {
+		maxNorm, norm float64
+		dense, sparse float64
+	}{
+		{10, 5, 3, 4},
+		{1, 5, .6, .8},
+		{1, 1, .6, .8},
+	}
+
+	for i, test := range tests {
+		norm := ClipGrad(params, test.maxNorm)
+		if math.Abs(norm-test.norm) > 1e-12 ||
+			math.Abs(ddense.At(0, 0)-test.dense) > 1e-12 || math.Abs(dsparse.At(1, 0)-test.sparse) > 1e-12 {
+			t.Errorf("%d: %v %v %v", i+1, norm, ddense.Slice(), dsparse.Slice())
+		}
+	}
+
+	ddense.Set(0, 0, math.Inf(1))
+	if p := NonFiniteGrad(params); p != params[0] {
+		t.Errorf("%v", p)
+	}
+}
+
+func Test_Train(t *testing.T) {
+	if Training() {
+		t.Fatal("режим обучения по умолчанию")
+	}
+
+	prev := Train(true)
+	if prev || !Training() {
+		t.Errorf("%v %v", prev, Training())
+	}
+	if Train(prev); Training() {
+		t.Error("режим не восстановлен")
+	}
+}
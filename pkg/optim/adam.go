@@ -0,0 +1,85 @@
+package optim
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// Adam хранит для каждого параметра скользящие средние градиента M и его квадрата V.
+// Шаг: Value -= LRate * M'/(sqrt(V')+Eps), где M' и V' - средние с поправкой на смещение к нулю.
+// У разреженных параметров меняются только строки Rows, средние остальных строк не затухают.
+type Adam[T mat.Float] struct {
+	LRate float64 `json:"lrate"`
+	Beta1 float64 `json:"beta1"`
+	Beta2 float64 `json:"beta2"`
+	Eps   float64 `json:"eps"`
+	// WeightDecay штраф за размер весов.
+	// В Adam он прибавляется к градиенту (L2), в AdamW уменьшает веса отдельно от шага.
+	WeightDecay float64 `json:"weightDecay"`
+	// Decoupled true у AdamW
+	Decoupled bool `json:"decoupled"`
+	// Steps число выполненных шагов для поправки средних
+	Steps int `json:"steps"`
+
+	// скользящие средние M (Slots[0]) и V (Slots[1]) каждого параметра
+	state[T]
+}
+
+// NewAdam создаёт Adam с обычными beta1 = .9, beta2 = .999 и eps = 1e-8
+func NewAdam[T mat.Float](lrate float64) *Adam[T] {
+	return &Adam[T]{LRate: lrate, Beta1: .9, Beta2: .999, Eps: 1e-8}
+}
+
+// NewAdamW создаёт Adam с отделённым от градиента уменьшением весов
+func NewAdamW[T mat.Float](lrate, weightDecay float64) *Adam[T] {
+	a := NewAdam[T](lrate)
+	a.WeightDecay, a.Decoupled = weightDecay, true
+	return a
+}
+
+func (a *Adam[T]) Step(params []*nn.Param[T]) {
+	a.Steps++
+	bc1 := 1 - math.Pow(a.Beta1, float64(a.Steps))
+	bc2 := 1 - math.Pow(a.Beta2, float64(a.Steps))
+
+	for _, p := range params {
+		if p.Grad.RowN() == 0 {
+			continue
+		}
+		i := a.slot(p, 2)
+		m, v := a.Slots[0][i], a.Slots[1][i]
+
+		forRows(p, func(row int) {
+			a.update(p.Value.Row(row), p.Grad.Row(row), m.Row(row), v.Row(row), bc1, bc2)
+		})
+	}
+}
+
+func (a *Adam[T]) update(x, g, m, v []T, bc1, bc2 float64) {
+	for i := range x {
+		xi, gi := float64(x[i]), float64(g[i])
+		if !a.Decoupled {
+			gi += a.WeightDecay * xi
+		}
+
+		mi := a.Beta1*float64(m[i]) + (1-a.Beta1)*gi
+		vi := a.Beta2*float64(v[i]) + (1-a.Beta2)*gi*gi
+		m[i], v[i] = T(mi), T(vi)
+
+		step := mi / bc1 / (math.Sqrt(vi/bc2) + a.Eps)
+		if a.Decoupled {
+			step += a.WeightDecay * xi
+		}
+		x[i] = T(xi - a.LRate*step)
+	}
+}
+
+func (a *Adam[T]) SetLRate(lrate float64) {
+	a.LRate = lrate
+}
+
+// State средние M и V под именами "optim.m.<параметр>" и "optim.v.<параметр>"
+func (a *Adam[T]) State() []mat.Tensor[T] {
+	return a.tensors("m", "v")
+}
@@ -0,0 +1,88 @@
+// Package optim правила обновления параметров nn.Param по накопленным градиентам.
+// Обучение: Forward, Backward, затем Trainer.Step или opt.Step(params) и nn.ZeroGrad(params).
+package optim
+
+import (
+	"fmt"
+	"ml/pkg/mat"
+	"ml/pkg/mlutil"
+	"ml/pkg/nn"
+	"ml/pkg/schedule"
+)
+
+type Optimizer[T mat.Float] interface {
+	// Step обновляет params по их Grad, градиенты не обнуляются
+	Step(params []*nn.Param[T])
+	// State матрицы состояния оптимизатора с именами для сохранения в контрольной точке
+	State() []mat.Tensor[T]
+	// SetLRate меняет скорость обучения следующих шагов, например по schedule.Schedule
+	SetLRate(lrate float64)
+}
+
+// Name название оптимизатора в настройках
+type Name string
+
+const (
+	NameSGD      Name = "sgd"
+	NameNesterov Name = "nesterov"
+	NameRMSProp  Name = "rmsprop"
+	NameAdagrad  Name = "adagrad"
+	NameAdam     Name = "adam"
+	NameAdamW    Name = "adamw"
+)
+
+var Names = []Name{NameSGD, NameNesterov, NameRMSProp, NameAdagrad, NameAdam, NameAdamW}
+
+// Config настройки оптимизатора, например из JSON файла обучения.
+// Остальные параметры имеют обычные значения конструкторов.
+type Config struct {
+	Name  Name    `json:"name"`
+	LRate float64 `json:"lrate"`
+	// Momentum для sgd и nesterov
+	Momentum float64 `json:"momentum,omitempty"`
+	// WeightDecay для adam и adamw
+	WeightDecay float64 `json:"weightDecay,omitempty"`
+}
+
+// New создаёт оптимизатор по названию, чтобы переключать их без изменения кода обучения
+func New[T mat.Float](cfg Config) (Optimizer[T], error) {
+	switch cfg.Name {
+	case NameSGD:
+		return NewMomentum[T](cfg.LRate, cfg.Momentum), nil
+	case NameNesterov:
+		return NewNesterov[T](cfg.LRate, cfg.Momentum), nil
+	case NameRMSProp:
+		return NewRMSProp[T](cfg.LRate), nil
+	case NameAdagrad:
+		return NewAdagrad[T](cfg.LRate), nil
+	case NameAdam:
+		a := NewAdam[T](cfg.LRate)
+		a.WeightDecay = cfg.WeightDecay
+		return a, nil
+	case NameAdamW:
+		return NewAdamW[T](cfg.LRate, cfg.WeightDecay), nil
+	}
+	return nil, fmt.Errorf("неизвестный оптимизатор %q, доступны %v", cfg.Name, Names)
+}
+
+// checkpoint модель, оптимизатор и расписание в JSON части файла тензоров
+type checkpoint struct {
+	Model    any `json:"model"`
+	Optim    any `json:"optim"`
+	Schedule any `json:"schedule"`
+}
+
+// SaveCheckpoint сохраняет model с матрицами tensors, состояние opt и положение sched в файл to,
+// чтобы продолжить обучение с того же места. sched может быть nil.
+func SaveCheckpoint[T mat.Float](to string, model any, tensors []mat.Tensor[T], opt Optimizer[T], sched schedule.Schedule) error {
+	return mlutil.SaveModel(to, checkpoint{Model: model, Optim: opt, Schedule: sched},
+		append(tensors, opt.State()...))
+}
+
+// LoadCheckpoint загружает файл SaveCheckpoint в model, opt и sched.
+// model, opt и sched должны быть указателями, tensors как в mlutil.LoadModel.
+func LoadCheckpoint[T mat.Float](src string, model any, tensors func() []mat.Tensor[T], opt Optimizer[T], sched schedule.Schedule) error {
+	return mlutil.LoadModel(src, &checkpoint{Model: model, Optim: opt, Schedule: sched}, func() []mat.Tensor[T] {
+		return append(tensors(), opt.State()...)
+	})
+}
@@ -0,0 +1,201 @@
+package optim
+
+import (
+	"errors"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/mlp"
+	"ml/pkg/nn"
+	"ml/pkg/schedule"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// regression задача y = sin(x1) + x2 для маленького MLP
+type regression struct {
+	mlp    *mlp.MLP[float64]
+	x, y   mat.Mat[float64]
+	params []*nn.Param[float64]
+}
+
+func newRegression() *regression {
+	x := mat.New[float64](8, 2).Rand()
+	y := mat.New[float64](8, 1)
+	for row := range x.RowN() {
+		y.Set(row, 0, math.Sin(3*x.At(row, 0))+x.At(row, 1))
+	}
+
+	m := mlp.New[float64](.1, 8, 2, 16, 1)
+	return &regression{mlp: m, x: x, y: y, params: m.Parameters()}
+}
+
+// step делает шаг opt и возвращает среднеквадратичную ошибку до шага
+func (r *regression) step(opt Optimizer[float64]) float64 {
+	diff := r.mlp.Forward(r.x).Sub(r.y)
+	loss := diff.MulElwise(diff).ColSum().At(0, 0) / float64(diff.RowN())
+
+	r.mlp.Backward(diff.Scale(2 / float64(diff.RowN())))
+	opt.Step(r.params)
+	nn.ZeroGrad(r.params)
+
+	return loss
+}
+
+func Test_Adam_Step(t *testing.T) {
+	tests := []struct {
+		opt  *Adam[float64]
+		want []float64
+	}{
+		//первый шаг Adam равен lrate в сторону, противоположную градиенту
+		{NewAdam[float64](.1), []float64{.9, -1.9}},
+		{NewAdamW[float64](.1, .5), []float64{.85, -1.8}},
+	}
+
+	for i, test := range tests {
+		x, dx := mat.FromRows([][]float64{{1, -2}}), mat.FromRows([][]float64{{.5, -3}})
+		test.opt.Step([]*nn.Param[float64]{{Name: "x", Value: &x, Grad: &dx}})
+
+		for col, want := range test.want {
+			if math.Abs(x.At(0, col)-want) > 1e-6 {
+				t.Errorf("%d: %v != %v", i+1, x.Row(0), test.want)
+			}
+		}
+	}
+}
+
+func Test_Adam_Sparse(t *testing.T) {
+	x, dx := mat.FromRows([][]float64{{1}, {2}, {3}}), mat.FromRows([][]float64{{0}, {1}, {0}})
+	rows := []int{1}
+
+	NewAdam[float64](.1).Step([]*nn.Param[float64]{{Name: "x", Value: &x, Grad: &dx, Rows: &rows}})
+
+	if x.At(0, 0) != 1 || x.At(2, 0) != 3 || math.Abs(x.At(1, 0)-1.9) > 1e-6 {
+		t.Errorf("%v", x.Slice())
+	}
+}
+
+func Test_State_Shape(t *testing.T) {
+	for _, name := range Names {
+		opt, err := New[float64](Config{Name: name, LRate: .1, Momentum: .9})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x, dx := mat.New[float64](1, 2), mat.New[float64](1, 2).Rand()
+		opt.Step([]*nn.Param[float64]{{Name: "x", Value: &x, Grad: &dx}})
+
+		//другая матрица под тем же именем не получает чужое состояние
+		y, dy := mat.New[float64](2, 2), mat.New[float64](2, 2).Rand()
+		err = func() (err error) {
+			defer mat.Catch(&err)
+			opt.Step([]*nn.Param[float64]{{Name: "x", Value: &y, Grad: &dy}})
+			return nil
+		}()
+
+		var shapeErr *mat.ShapeError
+		if !errors.As(err, &shapeErr) || !strings.Contains(err.Error(), "x") {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func Test_Optimizers_Loss(t *testing.T) {
+	configs := map[Name]Config{
+		NameSGD:      {LRate: .05, Momentum: .9},
+		NameNesterov: {LRate: .05, Momentum: .9},
+		NameRMSProp:  {LRate: .005},
+		NameAdagrad:  {LRate: .05},
+		NameAdam:     {LRate: .01},
+		NameAdamW:    {LRate: .01, WeightDecay: .01},
+	}
+
+	for _, name := range Names {
+		cfg := configs[name]
+		cfg.Name = name
+		opt, err := New[float64](cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := newRegression()
+		first := r.step(opt)
+		for range 300 {
+			r.step(opt)
+		}
+		if last := r.step(opt); !(last < first/4) {
+			t.Errorf("%s: %v -> %v", name, first, last)
+		}
+	}
+
+	if _, err := New[float64](Config{Name: "lbfgs"}); err == nil {
+		t.Errorf("нет ошибки")
+	}
+}
+
+func Test_SGD_Step(t *testing.T) {
+	tests := []struct {
+		opt  *SGD[float64]
+		want float64
+	}{
+		//v = 1, затем v = .5 + 1
+		{NewSGD[float64](.1), .8},
+		{NewMomentum[float64](.1, .5), .75},
+		//шаг по g + mu*v: 1.5, затем 1.75
+		{NewNesterov[float64](.1, .5), .675},
+	}
+
+	for i, test := range tests {
+		x, dx := mat.FromRows([][]float64{{1}}), mat.FromRows([][]float64{{1}})
+		params := []*nn.Param[float64]{{Name: "x", Value: &x, Grad: &dx}}
+		test.opt.Step(params)
+		test.opt.Step(params)
+
+		if math.Abs(x.At(0, 0)-test.want) > 1e-12 {
+			t.Errorf("%d: %v != %v", i+1, x.At(0, 0), test.want)
+		}
+	}
+}
+
+func Test_Checkpoint(t *testing.T) {
+	r := newRegression()
+	opt := NewAdamW[float64](.01, .01)
+	sched := &schedule.Cosine{Rate: .01, Warmup: 2, Total: 10}
+	for range 3 {
+		opt.SetLRate(sched.LRate())
+		sched.Next(r.step(opt))
+	}
+
+	src := filepath.Join(t.TempDir(), "checkpoint")
+	if err := SaveCheckpoint(src, r.mlp, r.mlp.Tensors(""), opt, sched); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded mlp.MLP[float64]
+	loadedOpt, loadedSched := NewAdam[float64](1), &schedule.Cosine{}
+	err := LoadCheckpoint(src, &loaded, func() []mat.Tensor[float64] { return loaded.Tensors("") }, loadedOpt, loadedSched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedOpt.Steps != 3 || !loadedOpt.Decoupled || loadedOpt.LRate != opt.LRate {
+		t.Fatalf("%+v", loadedOpt)
+	}
+	if *loadedSched != *sched {
+		t.Fatalf("%+v != %+v", *loadedSched, *sched)
+	}
+
+	//продолжение с загруженным состоянием совпадает с непрерывным обучением
+	resumed := &regression{mlp: &loaded, x: r.x, y: r.y, params: loaded.Parameters()}
+	for range 2 {
+		opt.SetLRate(sched.LRate())
+		sched.Next(r.step(opt))
+		loadedOpt.SetLRate(loadedSched.LRate())
+		loadedSched.Next(resumed.step(loadedOpt))
+	}
+
+	for i, p := range r.params {
+		if !p.Value.Equal(*resumed.params[i].Value) {
+			t.Errorf("%s: %v != %v", p.Name, p.Value.Slice(), resumed.params[i].Value.Slice())
+		}
+	}
+}
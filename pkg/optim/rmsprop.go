@@ -0,0 +1,67 @@
+package optim
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// RMSProp делит шаг на корень скользящего среднего квадрата градиента:
+// S = Alpha*S + (1-Alpha)*Grad², Value -= LRate*Grad/(sqrt(S)+Eps).
+// Adagrad - то же с суммой всех квадратов вместо среднего.
+type RMSProp[T mat.Float] struct {
+	LRate float64 `json:"lrate"`
+	Alpha float64 `json:"alpha"`
+	Eps   float64 `json:"eps"`
+	// Sum true у Adagrad: S = S + Grad²
+	Sum bool `json:"sum"`
+
+	// средние квадраты S (Slots[0]) каждого параметра
+	state[T]
+}
+
+// NewRMSProp создаёт RMSProp с обычными alpha = .99 и eps = 1e-8
+func NewRMSProp[T mat.Float](lrate float64) *RMSProp[T] {
+	return &RMSProp[T]{LRate: lrate, Alpha: .99, Eps: 1e-8}
+}
+
+// NewAdagrad создаёт Adagrad с eps = 1e-10
+func NewAdagrad[T mat.Float](lrate float64) *RMSProp[T] {
+	return &RMSProp[T]{LRate: lrate, Eps: 1e-10, Sum: true}
+}
+
+func (r *RMSProp[T]) Step(params []*nn.Param[T]) {
+	for _, p := range params {
+		if p.Grad.RowN() == 0 {
+			continue
+		}
+		i := r.slot(p, 1)
+		sq := r.Slots[0][i]
+
+		forRows(p, func(row int) {
+			r.update(p.Value.Row(row), p.Grad.Row(row), sq.Row(row))
+		})
+	}
+}
+
+func (r *RMSProp[T]) update(x, g, sq []T) {
+	for i := range x {
+		gi, si := float64(g[i]), float64(sq[i])
+		if r.Sum {
+			si += gi * gi
+		} else {
+			si = r.Alpha*si + (1-r.Alpha)*gi*gi
+		}
+		sq[i] = T(si)
+		x[i] -= T(r.LRate * gi / (math.Sqrt(si) + r.Eps))
+	}
+}
+
+func (r *RMSProp[T]) SetLRate(lrate float64) {
+	r.LRate = lrate
+}
+
+// State средние квадраты под именами "optim.sq.<параметр>"
+func (r *RMSProp[T]) State() []mat.Tensor[T] {
+	return r.tensors("sq")
+}
@@ -0,0 +1,71 @@
+package optim
+
+import (
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// SGD градиентный спуск с необязательным моментом.
+// С моментом накапливается скорость V = Momentum*V + Grad и шаг делается по V,
+// в варианте Нестерова - по Grad + Momentum*V, то есть с заглядыванием вперёд.
+type SGD[T mat.Float] struct {
+	LRate    float64 `json:"lrate"`
+	Momentum float64 `json:"momentum"`
+	Nesterov bool    `json:"nesterov"`
+
+	// скорость V (Slots[0]) каждого параметра, только при Momentum != 0
+	state[T]
+}
+
+// NewSGD создаёт обычный градиентный спуск: Value -= lrate*Grad
+func NewSGD[T mat.Float](lrate float64) *SGD[T] {
+	return &SGD[T]{LRate: lrate}
+}
+
+func NewMomentum[T mat.Float](lrate, momentum float64) *SGD[T] {
+	return &SGD[T]{LRate: lrate, Momentum: momentum}
+}
+
+func NewNesterov[T mat.Float](lrate, momentum float64) *SGD[T] {
+	return &SGD[T]{LRate: lrate, Momentum: momentum, Nesterov: true}
+}
+
+func (s *SGD[T]) Step(params []*nn.Param[T]) {
+	if s.Momentum == 0 {
+		nn.Step(params, s.LRate)
+		return
+	}
+
+	for _, p := range params {
+		if p.Grad.RowN() == 0 {
+			continue
+		}
+		i := s.slot(p, 1)
+		v := s.Slots[0][i]
+
+		forRows(p, func(row int) {
+			s.update(p.Value.Row(row), p.Grad.Row(row), v.Row(row))
+		})
+	}
+}
+
+func (s *SGD[T]) update(x, g, v []T) {
+	mu := T(s.Momentum)
+	for i := range x {
+		v[i] = mu*v[i] + g[i]
+		step := v[i]
+		if s.Nesterov {
+			step = g[i] + mu*v[i]
+		}
+		x[i] -= T(s.LRate) * step
+	}
+}
+
+func (s *SGD[T]) SetLRate(lrate float64) {
+	s.LRate = lrate
+}
+
+// State скорости под именами "optim.velocity.<параметр>"
+func (s *SGD[T]) State() []mat.Tensor[T] {
+	return s.tensors("velocity")
+}
@@ -0,0 +1,74 @@
+package optim
+
+import (
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+)
+
+// state матрицы состояния оптимизатора, по несколько на каждый параметр.
+// Параметры узнаются по имени, поэтому состояние переживает сохранение и загрузку.
+type state[T mat.Float] struct {
+	// Names имена параметров в порядке матриц Slots
+	Names []string `json:"names"`
+	// Slots[k][i] k-я матрица состояния параметра Names[i]
+	Slots [][]mat.Mat[T] `json:"slots"`
+	index map[string]int
+}
+
+// slot возвращает номер параметра p, при первом шаге создаёт n нулевых матриц его размера.
+// Если под именем p уже хранится состояние другого размера, паникует с mat.ShapeError.
+func (s *state[T]) slot(p *nn.Param[T], n int) int {
+	if s.index == nil {
+		s.index = make(map[string]int, len(s.Names))
+		for i, name := range s.Names {
+			s.index[name] = i
+		}
+	}
+
+	i, ok := s.index[p.Name]
+	if ok {
+		for _, slots := range s.Slots {
+			if m := slots[i]; m.RowN() != p.Value.RowN() || m.ColN() != p.Value.ColN() {
+				panic(&mat.ShapeError{Op: "optim: состояние " + p.Name,
+					A: [2]int{m.RowN(), m.ColN()}, B: [2]int{p.Value.RowN(), p.Value.ColN()}})
+			}
+		}
+		return i
+	}
+
+	if s.Slots == nil {
+		s.Slots = make([][]mat.Mat[T], n)
+	}
+	i = len(s.Names)
+	s.index[p.Name] = i
+	s.Names = append(s.Names, p.Name)
+	for k := range s.Slots {
+		s.Slots[k] = append(s.Slots[k], mat.New[T](p.Value.RowN(), p.Value.ColN()))
+	}
+
+	return i
+}
+
+// tensors матрицы состояния под именами "optim.<names[k]>.<параметр>"
+func (s *state[T]) tensors(names ...string) []mat.Tensor[T] {
+	tensors := make([]mat.Tensor[T], 0, len(names)*len(s.Names))
+	for i, param := range s.Names {
+		for k, name := range names {
+			tensors = append(tensors, mat.Tensor[T]{Name: "optim." + name + "." + param, Mat: &s.Slots[k][i]})
+		}
+	}
+	return tensors
+}
+
+// forRows вызывает f для каждой обновляемой строки p: всех строк или только Rows
+func forRows[T mat.Float](p *nn.Param[T], f func(row int)) {
+	if p.Rows != nil {
+		for _, row := range *p.Rows {
+			f(row)
+		}
+		return
+	}
+	for row := range p.Value.RowN() {
+		f(row)
+	}
+}
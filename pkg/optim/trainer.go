@@ -0,0 +1,126 @@
+package optim
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"ml/pkg/schedule"
+	"slices"
+)
+
+// Trainer шаг обучения: скорость из расписания, ограничение нормы градиентов
+// и защита весов от NaN и ±Inf
+type Trainer[T mat.Float] struct {
+	Opt Optimizer[T]
+	// Sched задаёт скорость каждого шага, nil - скорость Opt постоянна
+	Sched schedule.Schedule
+	// MaxNorm наибольшая общая L2 норма градиентов всех параметров, 0 - без ограничения
+	MaxNorm float64
+	// Rollback перед каждым шагом копирует веса и состояние Opt,
+	// чтобы вернуть их, если шаг испортит веса. Без него такой шаг возвращает ошибку.
+	// Счётчики шагов оптимизаторов не возвращаются.
+	Rollback bool
+
+	// Skipped число пропущенных и отменённых шагов
+	Skipped int
+
+	good map[string]mat.Mat[T]
+	//checked набор параметров, имена которого уже проверены
+	checked []*nn.Param[T]
+}
+
+// NewTrainer шаг обучения opt без расписания и ограничения нормы
+func NewTrainer[T mat.Float](opt Optimizer[T]) *Trainer[T] {
+	return &Trainer[T]{Opt: opt}
+}
+
+// Step применяет накопленные градиенты params и обнуляет их, loss - ошибка этого шага.
+// Шаг с NaN или ±Inf в loss или градиентах пропускается, расписание при этом не сдвигается.
+// Испорченный шагом тензор записывается в журнал, ошибка возвращается, только если
+// веса остались испорченными. Повторяющиеся имена params - тоже ошибка.
+func (tr *Trainer[T]) Step(params []*nn.Param[T], loss float64) error {
+	defer nn.ZeroGrad(params)
+
+	//состояние Opt и копии весов для отката хранятся по именам
+	if !slices.Equal(tr.checked, params) {
+		if err := nn.CheckNames(params); err != nil {
+			return err
+		}
+		tr.checked = slices.Clone(params)
+	}
+
+	if math.IsNaN(loss) || math.IsInf(loss, 0) {
+		tr.Skipped++
+		zap.S().Warnf("ошибка %v, шаг пропущен", loss)
+		return nil
+	}
+	if p := nn.NonFiniteGrad(params); p != nil {
+		tr.Skipped++
+		zap.S().Warnf("NaN или Inf в градиенте %s, шаг пропущен", p.Name)
+		return nil
+	}
+
+	if tr.MaxNorm > 0 {
+		nn.ClipGrad(params, tr.MaxNorm)
+	}
+	if tr.Rollback {
+		tr.save(params)
+	}
+
+	if tr.Sched != nil {
+		tr.Opt.SetLRate(tr.Sched.LRate())
+	}
+	tr.Opt.Step(params)
+
+	if name, ok := tr.check(params); !ok {
+		if !tr.Rollback {
+			return fmt.Errorf("optim: NaN или Inf в %s после шага", name)
+		}
+		tr.restore(params)
+		tr.Skipped++
+		zap.S().Warnf("NaN или Inf в %s после шага, веса возвращены", name)
+		return nil
+	}
+
+	if tr.Sched != nil {
+		tr.Sched.Next(loss)
+	}
+	return nil
+}
+
+// tensors веса params и состояние Opt
+func (tr *Trainer[T]) tensors(params []*nn.Param[T]) []mat.Tensor[T] {
+	return append(nn.Tensors(params), tr.Opt.State()...)
+}
+
+// check имя первого тензора с NaN или ±Inf
+func (tr *Trainer[T]) check(params []*nn.Param[T]) (string, bool) {
+	for _, t := range tr.tensors(params) {
+		if !t.Mat.Finite() {
+			return t.Name, false
+		}
+	}
+	return "", true
+}
+
+func (tr *Trainer[T]) save(params []*nn.Param[T]) {
+	if tr.good == nil {
+		tr.good = make(map[string]mat.Mat[T])
+	}
+	for _, t := range tr.tensors(params) {
+		tr.good[t.Name] = mat.Reuse(tr.good[t.Name], t.Mat.RowN(), t.Mat.ColN()).Copy(*t.Mat)
+	}
+}
+
+// restore возвращает сохранённые тензоры, созданное шагом состояние Opt обнуляется
+func (tr *Trainer[T]) restore(params []*nn.Param[T]) {
+	for _, t := range tr.tensors(params) {
+		if good, ok := tr.good[t.Name]; ok {
+			t.Mat.Copy(good)
+			continue
+		}
+		t.Mat.Zero()
+	}
+}
@@ -0,0 +1,112 @@
+package optim
+
+import (
+	"math"
+	"ml/pkg/mat"
+	"ml/pkg/nn"
+	"ml/pkg/schedule"
+	"testing"
+)
+
+func Test_Trainer(t *testing.T) {
+	tests := []struct {
+		loss     float64
+		grad     [][]float64
+		lrate    float64
+		maxNorm  float64
+		rollback bool
+		want     [][]float64
+		skipped  int
+		err      bool
+	}{
+		{1, [][]float64{{3, 4}}, 1, 0, false, [][]float64{{-2, -2}}, 0, false},
+		//градиент уменьшается до нормы 1
+		{1, [][]float64{{3, 4}}, 1, 1, false, [][]float64{{.4, 1.2}}, 0, false},
+		{1, [][]float64{{3, 4}}, 1, 10, false, [][]float64{{-2, -2}}, 0, false},
+		{math.NaN(), [][]float64{{3, 4}}, 1, 0, false, [][]float64{{1, 2}}, 1, false},
+		{1, [][]float64{{math.Inf(1), 4}}, 1, 0, false, [][]float64{{1, 2}}, 1, false},
+		//шаг переполняет веса
+		{1, [][]float64{{3, 4}}, math.MaxFloat64, 0, true, [][]float64{{1, 2}}, 1, false},
+		{1, [][]float64{{3, 4}}, math.MaxFloat64, 0, false, nil, 0, true},
+	}
+
+	for i, test := range tests {
+		w, g := mat.FromRows([][]float64{{1, 2}}), mat.FromRows(test.grad)
+		params := []*nn.Param[float64]{{Name: "w", Value: &w, Grad: &g}}
+		sched := &schedule.Constant{Rate: test.lrate}
+		tr := &Trainer[float64]{Opt: NewSGD[float64](0), Sched: sched, MaxNorm: test.maxNorm, Rollback: test.rollback}
+
+		err := tr.Step(params, test.loss)
+		if (err != nil) != test.err {
+			t.Errorf("%d: %v", i+1, err)
+			continue
+		}
+		if !g.Equal(mat.New[float64](1, 2)) {
+			t.Errorf("%d: градиент не обнулён %v", i+1, g.Slice())
+		}
+		if test.err {
+			continue
+		}
+
+		for col, v := range test.want[0] {
+			if math.Abs(w.At(0, col)-v) > 1e-12 {
+				t.Errorf("%d: %v != %v", i+1, w.Slice(), test.want)
+				break
+			}
+		}
+		//пропущенный шаг не сдвигает расписание
+		if tr.Skipped != test.skipped || sched.Step != 1-test.skipped {
+			t.Errorf("%d: %d %d", i+1, tr.Skipped, sched.Step)
+		}
+	}
+}
+
+func Test_Trainer_Names(t *testing.T) {
+	a, da := mat.FromRows([][]float64{{1, 2}}), mat.FromRows([][]float64{{1, 1}})
+	b, db := mat.FromRows([][]float64{{3}}), mat.FromRows([][]float64{{1}})
+	params := []*nn.Param[float64]{{Name: "w", Value: &a, Grad: &da}, {Name: "w", Value: &b, Grad: &db}}
+
+	//повтор имени - ошибка до шага, а не паника при откате
+	tr := &Trainer[float64]{Opt: NewAdam[float64](.1), Rollback: true}
+	if err := tr.Step(params, 1); err == nil || !a.Equal(mat.FromRows([][]float64{{1, 2}})) {
+		t.Errorf("%v %v", err, a.Slice())
+	}
+
+	params[1].Name = "v"
+	if err := tr.Step(params, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Trainer_Rollback(t *testing.T) {
+	r := newRegression()
+	tr := &Trainer[float64]{Opt: NewAdam[float64](.01), Rollback: true}
+	for range 2 {
+		r.mlp.Backward(r.mlp.Forward(r.x).Sub(r.y))
+		if err := tr.Step(r.params, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := tr.tensors(r.params)
+	for i := range want {
+		m := want[i].Mat.Clone()
+		want[i].Mat = &m
+	}
+
+	//испорченный градиент проходит проверку, но ломает состояние Adam
+	r.mlp.Backward(r.mlp.Forward(r.x).Sub(r.y))
+	r.params[0].Grad.Set(0, 0, math.MaxFloat64)
+	if err := tr.Step(r.params, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tensor := range tr.tensors(r.params) {
+		if !tensor.Mat.Equal(*want[i].Mat) {
+			t.Errorf("%s: %v != %v", tensor.Name, tensor.Mat.Slice(), want[i].Mat.Slice())
+		}
+	}
+	if tr.Skipped != 1 {
+		t.Errorf("%d != 1", tr.Skipped)
+	}
+}
@@ -0,0 +1,142 @@
+// Package schedule изменение скорости обучения по шагам.
+// Обучение на каждом шаге берёт LRate, делает шаг оптимизатора и вызывает Next.
+// Положение хранится в полях расписания, поэтому сохраняется в контрольной точке вместе с ним.
+package schedule
+
+import (
+	"math"
+)
+
+type Schedule interface {
+	// LRate скорость обучения текущего шага
+	LRate() float64
+	// Next переходит к следующему шагу, loss - ошибка завершённого шага
+	Next(loss float64)
+}
+
+// Pos номер текущего шага, общий для расписаний, зависящих только от него
+type Pos struct {
+	Step int `json:"step"`
+}
+
+func (p *Pos) Next(float64) {
+	p.Step++
+}
+
+// Constant постоянная скорость Rate
+type Constant struct {
+	Rate float64 `json:"rate"`
+	Pos
+}
+
+func (c *Constant) LRate() float64 {
+	return c.Rate
+}
+
+// StepDecay умножает Rate на Gamma каждые Every шагов, при Every <= 0 скорость не меняется
+type StepDecay struct {
+	Rate  float64 `json:"rate"`
+	Every int     `json:"every"`
+	Gamma float64 `json:"gamma"`
+	Pos
+}
+
+func (s *StepDecay) LRate() float64 {
+	if s.Every <= 0 {
+		return s.Rate
+	}
+	return s.Rate * math.Pow(s.Gamma, float64(s.Step/s.Every))
+}
+
+// Exponential умножает Rate на Gamma каждый шаг
+type Exponential struct {
+	Rate  float64 `json:"rate"`
+	Gamma float64 `json:"gamma"`
+	Pos
+}
+
+func (e *Exponential) LRate() float64 {
+	return e.Rate * math.Pow(e.Gamma, float64(e.Step))
+}
+
+// Cosine линейно растёт от 0 до Rate за Warmup шагов,
+// затем за оставшиеся до Total шаги спадает по косинусу до Min
+type Cosine struct {
+	Rate   float64 `json:"rate"`
+	Min    float64 `json:"min"`
+	Warmup int     `json:"warmup"`
+	Total  int     `json:"total"`
+	Pos
+}
+
+func (c *Cosine) LRate() float64 {
+	if c.Step < c.Warmup {
+		return warmup(c.Rate, c.Step, c.Warmup)
+	}
+	return c.Min + (c.Rate-c.Min)*(1+math.Cos(math.Pi*progress(c.Step, c.Warmup, c.Total)))/2
+}
+
+// Linear то же, что Cosine, но спадает до Min линейно
+type Linear struct {
+	Rate   float64 `json:"rate"`
+	Min    float64 `json:"min"`
+	Warmup int     `json:"warmup"`
+	Total  int     `json:"total"`
+	Pos
+}
+
+func (l *Linear) LRate() float64 {
+	if l.Step < l.Warmup {
+		return warmup(l.Rate, l.Step, l.Warmup)
+	}
+	return l.Rate + (l.Min-l.Rate)*progress(l.Step, l.Warmup, l.Total)
+}
+
+// warmup скорость шага step из warmup разогревающих, первый шаг не нулевой
+func warmup(rate float64, step, warmup int) float64 {
+	return rate * float64(step+1) / float64(warmup)
+}
+
+// progress доля пройденных после разогрева шагов, от 0 до 1
+func progress(step, warmup, total int) float64 {
+	if total <= warmup {
+		return 1
+	}
+	return min(1, float64(step-warmup)/float64(total-warmup))
+}
+
+// Plateau умножает скорость на Factor, если ошибка не уменьшалась Patience шагов подряд.
+// Скорость не опускается ниже Min.
+type Plateau struct {
+	Factor   float64 `json:"factor"`
+	Patience int     `json:"patience"`
+	Min      float64 `json:"min"`
+
+	// Rate текущая скорость
+	Rate float64 `json:"rate"`
+	// Best наименьшая ошибка, Bad число шагов без её улучшения
+	Best float64 `json:"best"`
+	Bad  int     `json:"bad"`
+}
+
+// NewPlateau создаёт Plateau с начальной скоростью rate.
+// Best начинается с MaxFloat64, а не с +Inf, который нельзя сохранить в JSON.
+func NewPlateau(rate, factor float64, patience int) *Plateau {
+	return &Plateau{Factor: factor, Patience: patience, Rate: rate, Best: math.MaxFloat64}
+}
+
+func (p *Plateau) LRate() float64 {
+	return p.Rate
+}
+
+func (p *Plateau) Next(loss float64) {
+	if loss < p.Best {
+		p.Best, p.Bad = loss, 0
+		return
+	}
+
+	p.Bad++
+	if p.Bad > p.Patience {
+		p.Rate, p.Bad = max(p.Min, p.Rate*p.Factor), 0
+	}
+}
@@ -0,0 +1,101 @@
+package schedule
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// rates скорости первых n шагов
+func rates(s Schedule, n int) []float64 {
+	ans := make([]float64, n)
+	for i := range ans {
+		ans[i] = s.LRate()
+		s.Next(0)
+	}
+	return ans
+}
+
+func Test_Schedules(t *testing.T) {
+	tests := []struct {
+		s    Schedule
+		want []float64
+	}{
+		{&Constant{Rate: .1}, []float64{.1, .1, .1}},
+		{&StepDecay{Rate: 1, Every: 2, Gamma: .5}, []float64{1, 1, .5, .5, .25}},
+		{&StepDecay{Rate: 1, Gamma: .5}, []float64{1, 1, 1}},
+		{&StepDecay{Rate: 1, Every: -1, Gamma: .5}, []float64{1, 1}},
+		{&Exponential{Rate: 1, Gamma: .5}, []float64{1, .5, .25}},
+		{&Cosine{Rate: 1, Warmup: 2, Total: 4}, []float64{.5, 1, 1, .5, 0, 0}},
+		{&Cosine{Rate: 1, Min: .5, Total: 2}, []float64{1, .75, .5, .5}},
+		{&Linear{Rate: 1, Warmup: 2, Total: 6}, []float64{.5, 1, 1, .75, .5, .25, 0, 0}},
+		{&Linear{Rate: 1, Min: 1}, []float64{1, 1}},
+	}
+
+	for i, test := range tests {
+		res := rates(test.s, len(test.want))
+		for step := range res {
+			if math.Abs(res[step]-test.want[step]) > 1e-12 {
+				t.Errorf("%d: %v != %v", i+1, res, test.want)
+				break
+			}
+		}
+	}
+}
+
+func Test_Plateau(t *testing.T) {
+	p := NewPlateau(1, .5, 1)
+	p.Min = .2
+
+	tests := []struct {
+		loss float64
+		want float64
+	}{
+		{3, 1},
+		{2, 1},
+		{2, 1},
+		{2.5, .5},
+		{1, .5},
+		{1, .5},
+		{1, .25},
+		{1, .25},
+		{1, .2},
+	}
+
+	for i, test := range tests {
+		p.Next(test.loss)
+		if p.LRate() != test.want {
+			t.Errorf("%d: %v != %v", i+1, p.LRate(), test.want)
+		}
+	}
+}
+
+func Test_Schedule_JSON(t *testing.T) {
+	tests := []struct {
+		s, loaded Schedule
+	}{
+		{&Cosine{Rate: 1, Warmup: 2, Total: 10}, &Cosine{}},
+		{NewPlateau(1, .5, 0), &Plateau{}},
+	}
+
+	for i, test := range tests {
+		rates(test.s, 3)
+
+		data, err := json.Marshal(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(data, test.loaded); err != nil {
+			t.Fatal(err)
+		}
+
+		//загруженное расписание продолжает ту же кривую
+		res, want := rates(test.loaded, 3), rates(test.s, 3)
+		for step := range res {
+			if res[step] != want[step] {
+				t.Errorf("%d: %v != %v", i+1, res, want)
+				break
+			}
+		}
+	}
+}